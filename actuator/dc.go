@@ -0,0 +1,128 @@
+package actuator
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/stianeikeland/go-rpio/v4"
+)
+
+// Duty cycle resolution of PWM output.
+const pwmCycle = 100
+
+// Pins with hardware PWM.
+var pwmPins = map[int]bool{12: true, 13: true, 18: true, 19: true}
+
+type DCConfig struct {
+	// H-bridge direction inputs.
+	In1Pin int `yaml:"in1_pin"`
+	In2Pin int `yaml:"in2_pin"`
+	// H-bridge enable input driven by PWM, must be a hardware PWM pin
+	// (12, 13, 18 or 19).
+	EnablePin int `yaml:"enable_pin"`
+	// PWM frequency in Hz.
+	Frequency int `yaml:"frequency"`
+	// Reverse direction of rotation.
+	Invert bool `yaml:"invert"`
+	// Short motor terminals when stopped to brake instead of coasting.
+	Brake bool `yaml:"brake"`
+}
+
+func DCDefaults() DCConfig {
+	return DCConfig{
+		In1Pin:    23,
+		In2Pin:    24,
+		EnablePin: 18,
+		Frequency: 20000,
+		Brake:     true,
+	}
+}
+
+// Validate returns error describing first problem found in config.
+func (c DCConfig) Validate() error {
+	switch {
+	case !pwmPins[c.EnablePin]:
+		return fmt.Errorf("enable_pin must be a hardware PWM pin, found %d", c.EnablePin)
+	case c.Frequency*pwmCycle < 4688 || c.Frequency*pwmCycle > 19200000:
+		return fmt.Errorf("frequency must be within [47, 192000], found %d", c.Frequency)
+	}
+	return nil
+}
+
+// SpeedMotor is implemented by motors that can't step. Controller drives
+// them by speed closing the loop on shaft angle.
+type SpeedMotor interface {
+	// Drive runs motor at fraction of full speed in [-1, 1]. Positive speed
+	// rotates shaft the same way as positive steps.
+	Drive(speed float64)
+}
+
+// DCMotor drives geared DC motor through H-bridge.
+type DCMotor struct {
+	cfg    DCConfig
+	in1    rpio.Pin
+	in2    rpio.Pin
+	enable rpio.Pin
+}
+
+func NewDCMotor(cfg DCConfig) *DCMotor {
+	fmt.Printf("creating dc motor at pins %d, %d with pwm on pin %d\n", cfg.In1Pin, cfg.In2Pin, cfg.EnablePin)
+	m := &DCMotor{
+		cfg:    cfg,
+		in1:    rpio.Pin(cfg.In1Pin),
+		in2:    rpio.Pin(cfg.In2Pin),
+		enable: rpio.Pin(cfg.EnablePin),
+	}
+	m.in1.Output()
+	m.in2.Output()
+	m.enable.Pwm()
+	m.enable.Freq(cfg.Frequency * pwmCycle)
+	m.PowerOff()
+	return m
+}
+
+// Drive sets direction and PWM duty. Zero speed brakes or coasts.
+func (m *DCMotor) Drive(speed float64) {
+	speed = math.Max(-1, math.Min(1, speed))
+	if m.cfg.Invert {
+		speed = -speed
+	}
+	switch {
+	case speed > 0:
+		m.in1.High()
+		m.in2.Low()
+	case speed < 0:
+		m.in1.Low()
+		m.in2.High()
+	default:
+		m.PowerOff()
+		return
+	}
+	m.enable.DutyCycle(uint32(math.Round(math.Abs(speed)*pwmCycle)), pwmCycle)
+}
+
+// Step is not supported as motor has no steps, controller uses Drive
+// instead.
+func (m *DCMotor) Step(delta int) {
+}
+
+// PowerOn does nothing as DC motor can't hold position.
+func (m *DCMotor) PowerOn() {
+}
+
+// PowerOff stops motor. Brake shorts motor terminals through the bridge.
+func (m *DCMotor) PowerOff() {
+	if m.cfg.Brake {
+		m.in1.High()
+		m.in2.High()
+		m.enable.DutyCycle(pwmCycle, pwmCycle)
+		return
+	}
+	m.in1.Low()
+	m.in2.Low()
+	m.enable.DutyCycle(0, pwmCycle)
+}
+
+func (m *DCMotor) Capabilities() Capabilities {
+	return Capabilities{}
+}
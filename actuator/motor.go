@@ -0,0 +1,91 @@
+package actuator
+
+import (
+	"fmt"
+	"time"
+)
+
+// Motor is a stepping motor driver used by controller to rotate shaft.
+type Motor interface {
+	// Step advances motor a single step. delta should be +1/-1 where +1 is
+	// clockwise if looking from sensor side.
+	Step(delta int)
+	// PowerOn energizes coils in current position to hold the shaft.
+	PowerOn()
+	// PowerOff releases coils.
+	PowerOff()
+	// Capabilities describes what driver supports.
+	Capabilities() Capabilities
+}
+
+// StallSensor is implemented by drivers that detect stalls on their own.
+type StallSensor interface {
+	// Stalled returns error if driver signalled stall. It is called after
+	// every step and must be cheap.
+	Stalled() error
+}
+
+// StatusMonitor is implemented by drivers that report stalls and faults
+// through status reads that are too slow for step loop.
+type StatusMonitor interface {
+	// PollInterval is how frequently status should be checked.
+	PollInterval() time.Duration
+	// CheckStatus returns error if driver detected stall or fault. It is
+	// called from a separate goroutine and must not touch step outputs.
+	CheckStatus() error
+}
+
+// Capabilities of motor driver.
+type Capabilities struct {
+	// Motor keeps shaft in place while powered on.
+	Holding bool
+	// Driver regulates coil current on its own, so coils must not be
+	// switched on and off to reduce hold current.
+	CurrentControl bool
+	// Motor half steps made by a single Step. Controller config is in half
+	// steps and is scaled by this value. Zero is treated as 1.
+	StepSize float64
+}
+
+// StepScale returns half steps made by a single Step.
+func (c Capabilities) StepScale() float64 {
+	if c.StepSize > 0 {
+		return c.StepSize
+	}
+	return 1
+}
+
+// NewMotor creates motor driver selected in config.
+func NewMotor(cfg Config) (Motor, error) {
+	switch cfg.Driver {
+	case DriverGPIO:
+		s := NewStepper(cfg.Pins, cfg.Mode)
+		return &s, nil
+	case DriverStepDir:
+		return NewStepDir(cfg.StepDir)
+	case DriverTMC2209:
+		tc := cfg.TMC2209
+		port, err := OpenUART(tc.Port, tc.Baud)
+		if err != nil {
+			return nil, fmt.Errorf("tmc2209: %w", err)
+		}
+		s := newStepPins(StepDirConfig{
+			Chip:       DriverTMC2209,
+			StepPin:    tc.StepPin,
+			DirPin:     tc.DirPin,
+			EnablePin:  tc.EnablePin,
+			Microsteps: tc.Microsteps,
+			Invert:     tc.Invert,
+			PulseWidth: tc.PulseWidth,
+		})
+		t, err := NewTMC2209(tc, port, s)
+		if err != nil {
+			port.Close()
+			return nil, err
+		}
+		return t, nil
+	case DriverDC:
+		return NewDCMotor(cfg.DC), nil
+	}
+	return nil, fmt.Errorf("unknown motor driver %q", cfg.Driver)
+}
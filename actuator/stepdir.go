@@ -0,0 +1,191 @@
+package actuator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/stianeikeland/go-rpio/v4"
+)
+
+// Driver chips supported by StepDir.
+const (
+	ChipA4988   = "a4988"
+	ChipDRV8825 = "drv8825"
+	ChipTMC2208 = "tmc2208"
+)
+
+// Levels of MS1-MS3 pins for microstep resolutions of driver chips.
+var microstepTables = map[string]map[int][]bool{
+	ChipA4988: {
+		1:  {false, false, false},
+		2:  {true, false, false},
+		4:  {false, true, false},
+		8:  {true, true, false},
+		16: {true, true, true},
+	},
+	ChipDRV8825: {
+		1:  {false, false, false},
+		2:  {true, false, false},
+		4:  {false, true, false},
+		8:  {true, true, false},
+		16: {false, false, true},
+		32: {true, false, true},
+	},
+	// Standalone mode only has MS1 and MS2, full steps are not available.
+	ChipTMC2208: {
+		2:  {true, false},
+		4:  {false, true},
+		8:  {false, false},
+		16: {true, true},
+	},
+}
+
+type StepDirConfig struct {
+	// Driver chip: a4988, drv8825 or tmc2208.
+	Chip    string `yaml:"chip"`
+	StepPin int    `yaml:"step_pin"`
+	DirPin  int    `yaml:"dir_pin"`
+	// Active low enable pin, negative if driver is always enabled.
+	EnablePin int `yaml:"enable_pin"`
+	// MS1-MS3 pins, empty if resolution is set with jumpers.
+	MicrostepPins []int `yaml:"microstep_pins"`
+	// Microsteps per full step.
+	Microsteps int `yaml:"microsteps"`
+	// Reverse direction of rotation.
+	Invert bool `yaml:"invert"`
+	// Min duration of step pulse and direction setup.
+	PulseWidth time.Duration `yaml:"pulse_width"`
+}
+
+func StepDirDefaults() StepDirConfig {
+	return StepDirConfig{
+		Chip:          ChipA4988,
+		StepPin:       20,
+		DirPin:        21,
+		EnablePin:     16,
+		MicrostepPins: []int{},
+		Microsteps:    1,
+		PulseWidth:    2 * time.Microsecond,
+	}
+}
+
+// MicrostepLevels returns levels of microstep pins for configured
+// resolution.
+func (c StepDirConfig) MicrostepLevels() ([]bool, error) {
+	table, ok := microstepTables[strings.ToLower(c.Chip)]
+	if !ok {
+		return nil, fmt.Errorf("unknown driver chip %q", c.Chip)
+	}
+	levels, ok := table[c.Microsteps]
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't support %d microsteps", c.Chip, c.Microsteps)
+	}
+	if len(c.MicrostepPins) > len(levels) {
+		return nil, fmt.Errorf("%s has %d microstep pins, found %d", c.Chip, len(levels), len(c.MicrostepPins))
+	}
+	return levels[:len(c.MicrostepPins)], nil
+}
+
+// StepDir drives stepper through a driver board with STEP and DIR inputs.
+type StepDir struct {
+	cfg    StepDirConfig
+	step   rpio.Pin
+	dir    rpio.Pin
+	enable rpio.Pin
+	// Direction of last step, zero if unknown.
+	lastDir int
+	enabled bool
+}
+
+func NewStepDir(cfg StepDirConfig) (*StepDir, error) {
+	fmt.Printf("creating step/dir driver %s at step pin %d, dir pin %d\n", cfg.Chip, cfg.StepPin, cfg.DirPin)
+	levels, err := cfg.MicrostepLevels()
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range cfg.MicrostepPins {
+		pin := rpio.Pin(p)
+		pin.Output()
+		if levels[i] {
+			pin.High()
+		} else {
+			pin.Low()
+		}
+	}
+	return newStepPins(cfg), nil
+}
+
+// newStepPins sets up step, dir and enable pins. Microstep pins are left
+// to the caller.
+func newStepPins(cfg StepDirConfig) *StepDir {
+	s := &StepDir{
+		cfg:  cfg,
+		step: rpio.Pin(cfg.StepPin),
+		dir:  rpio.Pin(cfg.DirPin),
+	}
+	s.step.Output()
+	s.step.Low()
+	s.dir.Output()
+	if cfg.EnablePin >= 0 {
+		s.enable = rpio.Pin(cfg.EnablePin)
+		s.enable.Output()
+	}
+	s.PowerOff()
+	return s
+}
+
+// wait busy waits for pulse width as sleeping takes way longer than
+// driver timings.
+func (s *StepDir) wait() {
+	for start := time.Now(); time.Since(start) < s.cfg.PulseWidth; {
+	}
+}
+
+// Step makes a single microstep. +1 is clockwise if looking from sensor
+// side unless inverted.
+func (s *StepDir) Step(delta int) {
+	if delta != 1 && delta != -1 {
+		return
+	}
+	if !s.enabled {
+		s.PowerOn()
+	}
+	if delta != s.lastDir {
+		s.lastDir = delta
+		if (delta > 0) != s.cfg.Invert {
+			s.dir.High()
+		} else {
+			s.dir.Low()
+		}
+		s.wait()
+	}
+	s.step.High()
+	s.wait()
+	s.step.Low()
+}
+
+func (s *StepDir) PowerOn() {
+	s.enabled = true
+	if s.cfg.EnablePin >= 0 {
+		s.enable.Low()
+	}
+}
+
+// PowerOff disables driver outputs. Without enable pin driver keeps
+// holding the shaft.
+func (s *StepDir) PowerOff() {
+	s.enabled = false
+	if s.cfg.EnablePin >= 0 {
+		s.enable.High()
+	}
+}
+
+// Full step is two half steps.
+func (s *StepDir) Capabilities() Capabilities {
+	return Capabilities{
+		Holding:        true,
+		CurrentControl: true,
+		StepSize:       2 / float64(s.cfg.Microsteps),
+	}
+}
@@ -12,31 +12,101 @@ var DefaultPins = []int{
 	26, 13, 6, 5,
 }
 
-const coilSteps = 8
-
-var coilSeq = [8]int{
-	0b0001,
-	0b0011,
-	0b0010,
-	0b0110,
-	0b0100,
-	0b1100,
-	0b1000,
-	0b1001,
+// Motor drivers.
+const (
+	// Coils driven directly from GPIO pins.
+	DriverGPIO = "gpio"
+	// Driver board with STEP and DIR inputs.
+	DriverStepDir = "step_dir"
+	// TMC2209 with STEP and DIR inputs configured over UART.
+	DriverTMC2209 = "tmc2209"
+	// DC motor with H-bridge.
+	DriverDC = "dc"
+)
+
+type Config struct {
+	// Motor driver: gpio, step_dir, tmc2209 or dc.
+	Driver string `yaml:"driver"`
+	// GPIO pins of stepper coils.
+	Pins []int `yaml:"pins"`
+	// Coil sequence of gpio driver: wave, full or half.
+	Mode string `yaml:"mode"`
+	// Driver board settings.
+	StepDir StepDirConfig `yaml:"step_dir"`
+	TMC2209 TMC2209Config `yaml:"tmc2209"`
+	DC      DCConfig      `yaml:"dc"`
+}
+
+func Defaults() Config {
+	return Config{
+		Driver:  DriverGPIO,
+		Pins:    DefaultPins,
+		Mode:    ModeHalf,
+		StepDir: StepDirDefaults(),
+		TMC2209: TMC2209Defaults(),
+		DC:      DCDefaults(),
+	}
+}
+
+// Coil sequences.
+const (
+	// One coil at a time, lowest power and torque.
+	ModeWave = "wave"
+	// Two coils at a time, max torque.
+	ModeFull = "full"
+	// Alternating one and two coils, smoothest with twice as many steps.
+	ModeHalf = "half"
+)
+
+var coilSeqs = map[string][]int{
+	ModeWave: {
+		0b0001,
+		0b0010,
+		0b0100,
+		0b1000,
+	},
+	ModeFull: {
+		0b0011,
+		0b0110,
+		0b1100,
+		0b1001,
+	},
+	ModeHalf: {
+		0b0001,
+		0b0011,
+		0b0010,
+		0b0110,
+		0b0100,
+		0b1100,
+		0b1000,
+		0b1001,
+	},
+}
+
+// ValidMode checks if coil sequence mode is known.
+func ValidMode(mode string) bool {
+	_, ok := coilSeqs[mode]
+	return ok
 }
 
 type Stepper struct {
 	// GPIO pins stepper is connected to.
 	pins [stepperPins]rpio.Pin
+	// Coil sequence.
+	seq []int
 	// Current position (in coil sequence).
 	pos int
 }
 
-func NewStepper(pinNums []int) Stepper {
-	fmt.Printf("creating new stepper at pins %d\n", pinNums)
+func NewStepper(pinNums []int, mode string) Stepper {
+	fmt.Printf("creating new stepper at pins %d in %s step mode\n", pinNums, mode)
 	if c := len(pinNums); c != stepperPins {
 		panic(fmt.Sprintf("stepper: incorrect number of pins in definition. found %d expected %d", c, stepperPins))
 	}
+	seq, ok := coilSeqs[mode]
+	if !ok {
+		panic(fmt.Sprintf("stepper: unknown step mode %q", mode))
+	}
 
 	var pins [stepperPins]rpio.Pin
 	for i, p := range pinNums {
@@ -45,7 +115,7 @@ func NewStepper(pinNums []int) Stepper {
 		pins[i].Low()
 	}
 
-	return Stepper{pins: pins}
+	return Stepper{pins: pins, seq: seq}
 }
 
 // delta should be +1/-1 only, otherwise it will just skip.
@@ -54,15 +124,15 @@ func (s *Stepper) Step(delta int) {
 	s.pos = s.pos + delta
 	switch {
 	case s.pos < 0:
-		s.pos = coilSteps - 1
-	case s.pos == coilSteps:
+		s.pos = len(s.seq) - 1
+	case s.pos == len(s.seq):
 		s.pos = 0
 	}
 	s.setPins()
 }
 
 func (s *Stepper) setPins() {
-	v := coilSeq[s.pos]
+	v := s.seq[s.pos]
 	for i := 0; i < stepperPins; i++ {
 		if v&1 == 0 {
 			s.pins[i].Low()
@@ -82,3 +152,10 @@ func (s *Stepper) PowerOff() {
 		s.pins[i].Low()
 	}
 }
+
+func (s *Stepper) Capabilities() Capabilities {
+	return Capabilities{
+		Holding:  true,
+		StepSize: float64(len(coilSeqs[ModeHalf]) / len(s.seq)),
+	}
+}
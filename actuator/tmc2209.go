@@ -0,0 +1,463 @@
+package actuator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"time"
+
+	"github.com/stianeikeland/go-rpio/v4"
+)
+
+// TMC2209 registers used by driver.
+const (
+	TMCGConf     = 0x00
+	TMCGStat     = 0x01
+	TMCIfCnt     = 0x02
+	TMCIOIn      = 0x06
+	TMCIHoldIRun = 0x10
+	TMCTStep     = 0x12
+	TMCTPwmThrs  = 0x13
+	TMCTCoolThrs = 0x14
+	TMCSGThrs    = 0x40
+	TMCSGResult  = 0x41
+	TMCChopConf  = 0x6c
+	TMCDrvStatus = 0x6f
+)
+
+// TMCVersion is chip version found in IOIN register.
+const TMCVersion = 0x21
+
+// First byte of every UART datagram.
+const tmcSync = 0x05
+
+// Register bits.
+const (
+	gconfSpreadCycle   = 1 << 2
+	gconfPdnDisable    = 1 << 6
+	gconfMstepRegSel   = 1 << 7
+	gconfMultistepFilt = 1 << 8
+
+	gstatReset  = 1 << 0
+	gstatDrvErr = 1 << 1
+
+	chopconfVSense = 1 << 17
+	chopconfIntpol = 1 << 28
+
+	drvOverTempWarn = 1 << 0
+	drvOverTemp     = 1 << 1
+	drvShortGround  = 0b11 << 2
+	drvShortSupply  = 0b11 << 4
+	drvOpenLoad     = 0b11 << 6
+	drvStealth      = 1 << 30
+	drvStandstill   = 1 << 31
+)
+
+// Internal clock frequency used for TSTEP and threshold registers.
+const tmcClock = 12e6
+
+type TMC2209Config struct {
+	// Serial port of single wire UART.
+	Port string `yaml:"port"`
+	Baud int    `yaml:"baud"`
+	// Driver address set by MS1 and MS2 pins, 0 to 3.
+	Addr uint8 `yaml:"addr"`
+	// Sent bytes are read back when TX and RX share a wire.
+	Echo    bool `yaml:"echo"`
+	StepPin int  `yaml:"step_pin"`
+	DirPin  int  `yaml:"dir_pin"`
+	// Active low enable pin, negative if driver is always enabled.
+	EnablePin int `yaml:"enable_pin"`
+	// DIAG output pin, negative to poll StallGuard over UART instead.
+	DiagPin int `yaml:"diag_pin"`
+	// Microsteps per full step, power of two up to 256.
+	Microsteps int `yaml:"microsteps"`
+	// RMS motor current while moving and at standstill in mA.
+	RunCurrent  int `yaml:"run_current"`
+	HoldCurrent int `yaml:"hold_current"`
+	// Sense resistor of driver board in ohms.
+	SenseResistor float64 `yaml:"sense_resistor"`
+	// Use silent StealthChop instead of SpreadCycle.
+	StealthChop bool `yaml:"stealth_chop"`
+	// StallGuard sensitivity, higher values detect stall earlier. Zero
+	// disables stall detection. Only works with StealthChop.
+	StallThreshold int `yaml:"stall_threshold"`
+	// Min speed in steps/s at which StallGuard is used. Load measurement is
+	// unreliable at lower speeds.
+	StallMinSpeed float64 `yaml:"stall_min_speed"`
+	// How frequently status registers are polled.
+	StatusInterval time.Duration `yaml:"status_interval"`
+	// Reverse direction of rotation.
+	Invert bool `yaml:"invert"`
+	// Min duration of step pulse and direction setup.
+	PulseWidth time.Duration `yaml:"pulse_width"`
+}
+
+func TMC2209Defaults() TMC2209Config {
+	return TMC2209Config{
+		Port:           "/dev/serial0",
+		Baud:           115200,
+		Echo:           true,
+		StepPin:        20,
+		DirPin:         21,
+		EnablePin:      16,
+		DiagPin:        -1,
+		Microsteps:     8,
+		RunCurrent:     600,
+		HoldCurrent:    300,
+		SenseResistor:  0.11,
+		StealthChop:    true,
+		StallMinSpeed:  200,
+		StatusInterval: 100 * time.Millisecond,
+		PulseWidth:     2 * time.Microsecond,
+	}
+}
+
+// Validate returns error describing first problem found in config.
+func (c TMC2209Config) Validate() error {
+	switch {
+	case c.Addr > 3:
+		return fmt.Errorf("addr must be within [0, 3], found %d", c.Addr)
+	case c.Microsteps < 1 || c.Microsteps > 256 || bits.OnesCount(uint(c.Microsteps)) != 1:
+		return fmt.Errorf("microsteps must be a power of two up to 256, found %d", c.Microsteps)
+	case c.RunCurrent <= 0:
+		return fmt.Errorf("run_current must be positive, found %d", c.RunCurrent)
+	case c.HoldCurrent < 0 || c.HoldCurrent > c.RunCurrent:
+		return fmt.Errorf("hold_current must be within [0, run_current], found %d", c.HoldCurrent)
+	case c.SenseResistor <= 0:
+		return fmt.Errorf("sense_resistor must be positive")
+	case c.StallThreshold < 0 || c.StallThreshold > 255:
+		return fmt.Errorf("stall_threshold must be within [0, 255], found %d", c.StallThreshold)
+	case c.StallThreshold > 0 && !c.StealthChop:
+		return errors.New("stall_threshold requires stealth_chop")
+	case c.StallMinSpeed <= 0:
+		return fmt.Errorf("stall_min_speed must be positive")
+	case c.StatusInterval <= 0:
+		return fmt.Errorf("status_interval must be positive")
+	case c.PulseWidth <= 0:
+		return fmt.Errorf("pulse_width must be positive")
+	}
+	return nil
+}
+
+// TMCCRC computes CRC8 of UART datagram as defined by TMC datasheet.
+func TMCCRC(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		for i := 0; i < 8; i++ {
+			if (crc>>7)^(b&1) != 0 {
+				crc = (crc << 1) ^ 0x07
+			} else {
+				crc <<= 1
+			}
+			b >>= 1
+		}
+	}
+	return crc
+}
+
+// TMCUART accesses registers of a driver on single wire UART.
+type TMCUART struct {
+	port io.ReadWriter
+	addr uint8
+	echo bool
+}
+
+func NewTMCUART(port io.ReadWriter, addr uint8, echo bool) *TMCUART {
+	return &TMCUART{
+		port: port,
+		addr: addr,
+		echo: echo,
+	}
+}
+
+func (u *TMCUART) send(req []byte) error {
+	req[len(req)-1] = TMCCRC(req[:len(req)-1])
+	if _, err := u.port.Write(req); err != nil {
+		return err
+	}
+	if u.echo {
+		echo := make([]byte, len(req))
+		if _, err := io.ReadFull(u.port, echo); err != nil {
+			return fmt.Errorf("no echo of request: %w", err)
+		}
+	}
+	return nil
+}
+
+// Write sets register value. Writes are not acknowledged, check IFCNT to
+// confirm them.
+func (u *TMCUART) Write(reg uint8, v uint32) error {
+	return u.send([]byte{tmcSync, u.addr, reg | 0x80, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v), 0})
+}
+
+// Read returns register value.
+func (u *TMCUART) Read(reg uint8) (uint32, error) {
+	if err := u.send([]byte{tmcSync, u.addr, reg, 0}); err != nil {
+		return 0, err
+	}
+	reply := make([]byte, 8)
+	if _, err := io.ReadFull(u.port, reply); err != nil {
+		return 0, fmt.Errorf("no reply reading register %#x: %w", reg, err)
+	}
+	switch {
+	case reply[7] != TMCCRC(reply[:7]):
+		return 0, fmt.Errorf("bad crc reading register %#x", reg)
+	case reply[0] != tmcSync || reply[1] != 0xff || reply[2] != reg:
+		return 0, fmt.Errorf("unexpected reply % x reading register %#x", reply, reg)
+	}
+	return uint32(reply[3])<<24 | uint32(reply[4])<<16 | uint32(reply[5])<<8 | uint32(reply[6]), nil
+}
+
+// TMCStatus is decoded driver state.
+type TMCStatus struct {
+	// Driver was reset and lost configuration.
+	Reset bool
+	// Driver shut down because of overtemperature or short.
+	DriverError     bool
+	OverTemp        bool
+	OverTempWarning bool
+	ShortToGround   bool
+	ShortToSupply   bool
+	OpenLoad        bool
+	Standstill      bool
+	StealthChop     bool
+	// Actual current scale, 0 to 31.
+	Current int
+	// StallGuard load measurement, lower is higher load.
+	StallGuard int
+	// Time between 1/256 microsteps in clock cycles.
+	TStep uint32
+}
+
+// Status reads status registers.
+func (u *TMCUART) Status() (TMCStatus, error) {
+	var st TMCStatus
+	gstat, err := u.Read(TMCGStat)
+	if err != nil {
+		return st, err
+	}
+	drv, err := u.Read(TMCDrvStatus)
+	if err != nil {
+		return st, err
+	}
+	sg, err := u.Read(TMCSGResult)
+	if err != nil {
+		return st, err
+	}
+	tstep, err := u.Read(TMCTStep)
+	if err != nil {
+		return st, err
+	}
+	return TMCStatus{
+		Reset:           gstat&gstatReset != 0,
+		DriverError:     gstat&gstatDrvErr != 0,
+		OverTemp:        drv&drvOverTemp != 0,
+		OverTempWarning: drv&drvOverTempWarn != 0,
+		ShortToGround:   drv&drvShortGround != 0,
+		ShortToSupply:   drv&drvShortSupply != 0,
+		OpenLoad:        drv&drvOpenLoad != 0,
+		Standstill:      drv&drvStandstill != 0,
+		StealthChop:     drv&drvStealth != 0,
+		Current:         int(drv>>16) & 0x1f,
+		StallGuard:      int(sg & 0x3ff),
+		TStep:           tstep & 0xfffff,
+	}, nil
+}
+
+// currentScale computes current scale for RMS current in mA with high or
+// low sensitivity sense voltage range.
+func currentScale(mA int, rsense float64, vsense bool) int {
+	vfs := 0.325
+	if vsense {
+		vfs = 0.180
+	}
+	cs := int(math.Round(32*math.Sqrt2*float64(mA)/1000*(rsense+0.02)/vfs - 1))
+	return clampInt(cs, 0, 31)
+}
+
+func clampInt(v, min, max int) int {
+	switch {
+	case v < min:
+		return min
+	case v > max:
+		return max
+	}
+	return v
+}
+
+// TMC2209 drives stepper with STEP and DIR inputs and configures driver and
+// reads its status over UART.
+type TMC2209 struct {
+	cfg  TMC2209Config
+	m    Motor
+	uart *TMCUART
+	diag rpio.Pin
+	// StallGuard is used at speeds with TSTEP at or below this value.
+	coolThrs uint32
+}
+
+// NewTMC2209 configures driver on port. Stepping is done by motor m which
+// drives STEP, DIR and enable inputs.
+func NewTMC2209(cfg TMC2209Config, port io.ReadWriter, m Motor) (*TMC2209, error) {
+	fmt.Printf("creating tmc2209 driver at address %d\n", cfg.Addr)
+	t := &TMC2209{
+		cfg:  cfg,
+		m:    m,
+		uart: NewTMCUART(port, cfg.Addr, cfg.Echo),
+	}
+	if cfg.DiagPin >= 0 {
+		t.diag = rpio.Pin(cfg.DiagPin)
+		t.diag.Input()
+		t.diag.PullDown()
+	}
+	ioin, err := t.uart.Read(TMCIOIn)
+	if err != nil {
+		return nil, fmt.Errorf("tmc2209: %w", err)
+	}
+	if v := ioin >> 24; v != TMCVersion {
+		return nil, fmt.Errorf("tmc2209: unexpected chip version %#x", v)
+	}
+	if err := t.configure(); err != nil {
+		return nil, fmt.Errorf("tmc2209: %w", err)
+	}
+	return t, nil
+}
+
+// configure writes driver registers and checks that all writes were
+// received.
+func (t *TMC2209) configure() error {
+	cfg := t.cfg
+	before, err := t.uart.Read(TMCIfCnt)
+	if err != nil {
+		return err
+	}
+	chop, err := t.uart.Read(TMCChopConf)
+	if err != nil {
+		return err
+	}
+	// Low sense voltage range gives better resolution for small currents.
+	vsense := currentScale(cfg.RunCurrent, cfg.SenseResistor, false) < 16
+	mres := uint32(8 - bits.TrailingZeros(uint(cfg.Microsteps)))
+	chop = chop&^(0xf<<24|chopconfVSense) | mres<<24 | chopconfIntpol
+	if vsense {
+		chop |= chopconfVSense
+	}
+	gconf := uint32(gconfPdnDisable | gconfMstepRegSel | gconfMultistepFilt)
+	if !cfg.StealthChop {
+		gconf |= gconfSpreadCycle
+	}
+	irun := currentScale(cfg.RunCurrent, cfg.SenseResistor, vsense)
+	ihold := currentScale(cfg.HoldCurrent, cfg.SenseResistor, vsense)
+	t.coolThrs = 0
+	if cfg.StallThreshold > 0 {
+		// TSTEP counts 1/256 microsteps.
+		rate := cfg.StallMinSpeed * 256 / float64(cfg.Microsteps)
+		t.coolThrs = uint32(math.Min(tmcClock/rate, 0xfffff))
+	}
+	writes := []struct {
+		reg uint8
+		v   uint32
+	}{
+		{TMCGStat, gstatReset | gstatDrvErr},
+		{TMCGConf, gconf},
+		{TMCChopConf, chop},
+		// Current is reduced to hold current gradually after standstill.
+		{TMCIHoldIRun, uint32(ihold) | uint32(irun)<<8 | 8<<16},
+		// StealthChop is used at any speed when enabled.
+		{TMCTPwmThrs, 0},
+		{TMCTCoolThrs, t.coolThrs},
+		{TMCSGThrs, uint32(cfg.StallThreshold)},
+	}
+	for _, w := range writes {
+		if err := t.uart.Write(w.reg, w.v); err != nil {
+			return err
+		}
+	}
+	after, err := t.uart.Read(TMCIfCnt)
+	if err != nil {
+		return err
+	}
+	if n := int((after - before) & 0xff); n != len(writes) {
+		return fmt.Errorf("driver received %d of %d register writes", n, len(writes))
+	}
+	fmt.Printf("tmc2209: configured %d microsteps, run current scale %d, hold %d, stealthchop %t, stall threshold %d\n",
+		cfg.Microsteps, irun, ihold, cfg.StealthChop, cfg.StallThreshold)
+	return nil
+}
+
+// Status reads driver status over UART.
+func (t *TMC2209) Status() (TMCStatus, error) {
+	return t.uart.Status()
+}
+
+func (t *TMC2209) Step(delta int) {
+	t.m.Step(delta)
+}
+
+func (t *TMC2209) PowerOn() {
+	t.m.PowerOn()
+}
+
+func (t *TMC2209) PowerOff() {
+	t.m.PowerOff()
+}
+
+func (t *TMC2209) Capabilities() Capabilities {
+	return Capabilities{
+		Holding:        true,
+		CurrentControl: true,
+		StepSize:       2 / float64(t.cfg.Microsteps),
+	}
+}
+
+// Stalled checks DIAG pin. Without DIAG pin stalls are found by
+// CheckStatus.
+func (t *TMC2209) Stalled() error {
+	if t.cfg.StallThreshold > 0 && t.cfg.DiagPin >= 0 && t.diag.Read() == rpio.High {
+		return errors.New("motor stalled: driver reported stall on diag pin")
+	}
+	return nil
+}
+
+func (t *TMC2209) PollInterval() time.Duration {
+	return t.cfg.StatusInterval
+}
+
+// CheckStatus reads status registers over UART. Driver that lost its
+// configuration because of reset is reconfigured.
+func (t *TMC2209) CheckStatus() error {
+	st, err := t.uart.Status()
+	if err != nil {
+		// Link errors don't affect stepping, keep moving.
+		fmt.Printf("tmc2209: Err reading status: %s\n", err)
+		return nil
+	}
+	switch {
+	case st.OverTemp:
+		return errors.New("driver shut down: overtemperature")
+	case st.ShortToGround || st.ShortToSupply:
+		return errors.New("driver shut down: short circuit")
+	case st.DriverError:
+		return errors.New("driver shut down")
+	}
+	if st.OverTempWarning {
+		fmt.Println("tmc2209: Driver temperature warning")
+	}
+	if st.Reset {
+		fmt.Println("tmc2209: Driver was reset, reconfiguring")
+		if err := t.configure(); err != nil {
+			return fmt.Errorf("driver reconfiguration failed: %w", err)
+		}
+		return nil
+	}
+	// StallGuard flags stall when load measurement drops to twice the
+	// threshold. Below min speed measurement is meaningless.
+	if t.cfg.StallThreshold > 0 && t.cfg.DiagPin < 0 && !st.Standstill && st.TStep <= t.coolThrs &&
+		st.StallGuard <= 2*t.cfg.StallThreshold {
+		return fmt.Errorf("motor stalled: driver load measurement %d", st.StallGuard)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package actuator_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aliher1911/blinds/actuator"
+	"github.com/aliher1911/blinds/sim"
+)
+
+// recorder keeps copy of all bytes sent to port.
+type recorder struct {
+	io.ReadWriter
+	sent []byte
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.sent = append(r.sent, p...)
+	return r.ReadWriter.Write(p)
+}
+
+// lossy corrupts crc of write datagrams to register so that driver ignores
+// them.
+type lossy struct {
+	io.ReadWriter
+	reg uint8
+}
+
+func (l *lossy) Write(p []byte) (int, error) {
+	if len(p) == 8 && p[2] == l.reg|0x80 {
+		p = append([]byte(nil), p...)
+		p[7] ^= 0xff
+	}
+	return l.ReadWriter.Write(p)
+}
+
+type nopMotor struct{}
+
+func (nopMotor) Step(delta int) {}
+func (nopMotor) PowerOn()       {}
+func (nopMotor) PowerOff()      {}
+func (nopMotor) Capabilities() actuator.Capabilities {
+	return actuator.Capabilities{}
+}
+
+func testConfig(threshold int) actuator.TMC2209Config {
+	cfg := actuator.TMC2209Defaults()
+	cfg.DiagPin = -1
+	cfg.StallThreshold = threshold
+	return cfg
+}
+
+func TestTMCCRC(t *testing.T) {
+	// Read access of GCONF from datasheet.
+	if crc := actuator.TMCCRC([]byte{0x05, 0x00, 0x00}); crc != 0x48 {
+		t.Errorf("expected crc 0x48, got %#x", crc)
+	}
+}
+
+func TestTMCUARTFraming(t *testing.T) {
+	port := &recorder{ReadWriter: sim.NewTMC2209(1, func() bool { return false })}
+	u := actuator.NewTMCUART(port, 1, true)
+
+	if err := u.Write(actuator.TMCSGThrs, 0x12345678); err != nil {
+		t.Fatalf("write failed: %s", err)
+	}
+	wr := []byte{0x05, 0x01, 0xc0, 0x12, 0x34, 0x56, 0x78, 0x00}
+	wr[7] = actuator.TMCCRC(wr[:7])
+	if !bytes.Equal(port.sent, wr) {
+		t.Errorf("expected write datagram % x, got % x", wr, port.sent)
+	}
+
+	port.sent = nil
+	v, err := u.Read(actuator.TMCSGThrs)
+	if err != nil {
+		t.Fatalf("read failed: %s", err)
+	}
+	if v != 0x12345678 {
+		t.Errorf("expected %#x read back, got %#x", 0x12345678, v)
+	}
+	rd := []byte{0x05, 0x01, 0x40, 0x00}
+	rd[3] = actuator.TMCCRC(rd[:3])
+	if !bytes.Equal(port.sent, rd) {
+		t.Errorf("expected read datagram % x, got % x", rd, port.sent)
+	}
+	// Echo and reply must be consumed completely.
+	if n, _ := port.Read(make([]byte, 16)); n != 0 {
+		t.Errorf("%d bytes left unread", n)
+	}
+
+	// Without echo handling echoed request is taken for reply.
+	noEcho := actuator.NewTMCUART(sim.NewTMC2209(1, func() bool { return false }), 1, false)
+	if _, err := noEcho.Read(actuator.TMCIOIn); err == nil {
+		t.Error("expected read to fail when echo is not consumed")
+	}
+
+	// Driver doesn't reply to other addresses.
+	other := actuator.NewTMCUART(sim.NewTMC2209(1, func() bool { return false }), 2, true)
+	if _, err := other.Read(actuator.TMCIOIn); err == nil {
+		t.Error("expected read from wrong address to fail")
+	}
+}
+
+func TestTMC2209LostWrite(t *testing.T) {
+	port := &lossy{
+		ReadWriter: sim.NewTMC2209(0, func() bool { return false }),
+		reg:        actuator.TMCGConf,
+	}
+	_, err := actuator.NewTMC2209(testConfig(0), port, nopMotor{})
+	if err == nil || !strings.Contains(err.Error(), "received 6 of 7") {
+		t.Errorf("expected lost write to be detected, got %v", err)
+	}
+}
+
+func TestTMC2209Reconfigure(t *testing.T) {
+	model := sim.NewTMC2209(0, func() bool { return false })
+	drv, err := actuator.NewTMC2209(testConfig(50), model, nopMotor{})
+	if err != nil {
+		t.Fatalf("failed to create driver: %s", err)
+	}
+	u := actuator.NewTMCUART(model, 0, true)
+	mustRead := func(reg uint8) uint32 {
+		v, err := u.Read(reg)
+		if err != nil {
+			t.Fatalf("read of %#x failed: %s", reg, err)
+		}
+		return v
+	}
+	gconf, chop := mustRead(actuator.TMCGConf), mustRead(actuator.TMCChopConf)
+
+	model.Reset()
+	if v := mustRead(actuator.TMCGStat); v&1 == 0 {
+		t.Fatal("expected reset flag after reset")
+	}
+	if err := drv.CheckStatus(); err != nil {
+		t.Fatalf("unexpected status error: %s", err)
+	}
+	if v := mustRead(actuator.TMCGStat); v&1 != 0 {
+		t.Error("reset flag wasn't cleared by reconfiguration")
+	}
+	if v := mustRead(actuator.TMCGConf); v != gconf {
+		t.Errorf("expected gconf %#x after reconfiguration, got %#x", gconf, v)
+	}
+	if v := mustRead(actuator.TMCChopConf); v != chop {
+		t.Errorf("expected chopconf %#x after reconfiguration, got %#x", chop, v)
+	}
+	if v := mustRead(actuator.TMCSGThrs); v != 50 {
+		t.Errorf("expected stall threshold 50 after reconfiguration, got %d", v)
+	}
+}
+
+func TestTMC2209StallGuard(t *testing.T) {
+	// Model reports load measurement of 300 running freely and 0 when
+	// blocked.
+	for _, tc := range []struct {
+		name      string
+		threshold int
+		blocked   bool
+		stall     bool
+	}{
+		{name: "free", threshold: 50},
+		{name: "blocked", threshold: 50, blocked: true, stall: true},
+		{name: "below double threshold", threshold: 149},
+		{name: "at double threshold", threshold: 150, stall: true},
+		{name: "disabled", blocked: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			model := sim.NewTMC2209(0, func() bool { return tc.blocked })
+			drv, err := actuator.NewTMC2209(testConfig(tc.threshold), model, nopMotor{})
+			if err != nil {
+				t.Fatalf("failed to create driver: %s", err)
+			}
+			err = drv.CheckStatus()
+			switch {
+			case tc.stall && (err == nil || !strings.Contains(err.Error(), "stalled")):
+				t.Errorf("expected stall, got %v", err)
+			case !tc.stall && err != nil:
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
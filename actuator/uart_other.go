@@ -0,0 +1,13 @@
+//go:build !linux
+
+package actuator
+
+import (
+	"errors"
+	"io"
+)
+
+// OpenUART is only supported on Linux.
+func OpenUART(dev string, baud int) (io.ReadWriteCloser, error) {
+	return nil, errors.New("serial ports are only supported on linux")
+}
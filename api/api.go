@@ -0,0 +1,200 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aliher1911/blinds/ui"
+)
+
+// State is the JSON representation of blinds state.
+type State struct {
+	Target   int32  `json:"target"`
+	Angle    int32  `json:"angle"`
+	AtTarget bool   `json:"at_target"`
+	Auto     bool   `json:"auto"`
+	Fault    string `json:"fault,omitempty"`
+}
+
+// Target is the body of target update request.
+type Target struct {
+	Angle *int32 `json:"angle"`
+}
+
+// Mode is the body of auto mode update request.
+type Mode struct {
+	Auto *bool `json:"auto"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+const (
+	shutdownTimeout = 5 * time.Second
+	// Limits time clients can hold connection without sending request.
+	readHeaderTimeout = 5 * time.Second
+)
+
+// Server serves REST API for blinds.
+//
+//	GET  /state  - current state
+//	PUT  /target - set target angle
+//	POST /stop   - stop movement
+//	PUT  /auto   - enable or disable automatic control
+type Server struct {
+	srv *http.Server
+	doc ui.Document
+}
+
+func New(addr string, doc ui.Document) *Server {
+	s := &Server{
+		doc: doc,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/state", s.handleState)
+	mux.HandleFunc("/target", s.handleTarget)
+	mux.HandleFunc("/stop", s.handleStop)
+	mux.HandleFunc("/auto", s.handleAuto)
+	s.srv = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+	return s
+}
+
+// Run serves requests until context is cancelled. Should be started in a
+// separate goroutine.
+func (s *Server) Run(ctx context.Context) error {
+	errC := make(chan error, 1)
+	go func() {
+		fmt.Printf("api: listening on %s\n", s.srv.Addr)
+		errC <- s.srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errC:
+		return err
+	case <-ctx.Done():
+	}
+	sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.srv.Shutdown(sctx); err != nil {
+		return err
+	}
+	if err := <-errC; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return ctx.Err()
+}
+
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	s.writeState(w)
+}
+
+func (s *Server) handleTarget(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		s.methodNotAllowed(w, http.MethodPut)
+		return
+	}
+	var t Target
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %s", err))
+		return
+	}
+	if t.Angle == nil {
+		s.writeError(w, http.StatusBadRequest, "angle is required")
+		return
+	}
+	if !s.doc.Ready() {
+		s.notReady(w)
+		return
+	}
+	s.doc.SetAngle(*t.Angle)
+	s.writeState(w)
+}
+
+func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if !s.doc.Ready() {
+		s.notReady(w)
+		return
+	}
+	s.doc.Stop()
+	s.writeState(w)
+}
+
+func (s *Server) handleAuto(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		s.methodNotAllowed(w, http.MethodPut)
+		return
+	}
+	var m Mode
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %s", err))
+		return
+	}
+	if m.Auto == nil {
+		s.writeError(w, http.StatusBadRequest, "auto is required")
+		return
+	}
+	if !s.doc.Ready() {
+		s.notReady(w)
+		return
+	}
+	s.doc.SetAuto(*m.Auto)
+	s.writeState(w)
+}
+
+// writeState responds with current state. Angles are meaningless until
+// position is known, so service is reported unavailable instead.
+func (s *Server) writeState(w http.ResponseWriter) {
+	st := s.doc.GetState()
+	if !st.Ready {
+		s.notReady(w)
+		return
+	}
+	var fault string
+	if st.Fault != nil {
+		fault = st.Fault.Error()
+	}
+	s.writeJSON(w, http.StatusOK, State{
+		Target:   st.SetAngle,
+		Angle:    st.CurrentAngle,
+		AtTarget: st.AtTarget,
+		Auto:     st.Auto,
+		Fault:    fault,
+	})
+}
+
+func (s *Server) notReady(w http.ResponseWriter) {
+	s.writeError(w, http.StatusServiceUnavailable, "blinds position is not known yet")
+}
+
+func (s *Server) methodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+func (s *Server) writeError(w http.ResponseWriter, code int, msg string) {
+	s.writeJSON(w, code, errorResponse{Error: msg})
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Printf("api: failed to write response: %s\n", err)
+	}
+}
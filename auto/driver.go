@@ -0,0 +1,170 @@
+package auto
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Policy decides blinds angle automatically.
+type Policy interface {
+	// Target returns desired angle at given time and time when current
+	// decision was made. Manual override stays in effect until decision
+	// time changes. If policy has no opinion, ok is false.
+	Target(now time.Time) (angle int32, since time.Time, ok bool)
+}
+
+// Target receives angles chosen by policy.
+type Target interface {
+	SetTarget(angle int32)
+}
+
+type Config struct {
+	// How often policy is evaluated.
+	Interval time.Duration `yaml:"interval"`
+	// Time of day rules.
+	Schedule []Rule `yaml:"schedule"`
+	// Sun tracking for windows facing the sun.
+	Sun SunConfig `yaml:"sun"`
+	// Closing blinds in bright light measured by light sensor.
+	Light LightConfig `yaml:"light"`
+}
+
+func Defaults() Config {
+	return Config{
+		Interval: 30 * time.Second,
+		Sun:      SunDefaults(),
+		Light:    LightDefaults(),
+	}
+}
+
+// Driver applies policy decisions to target while auto mode is enabled.
+// Manual changes suspend it until policy makes a new decision.
+type Driver struct {
+	policy   Policy
+	target   Target
+	interval time.Duration
+
+	// Wakes up driver to apply changes immediately.
+	pokeC chan interface{}
+
+	mu      sync.Mutex
+	enabled bool
+	// Decision time from last policy evaluation.
+	decided  bool
+	decision time.Time
+	// Decision time of policy when user made manual change.
+	overridden    bool
+	overrideSince time.Time
+	// Last angle sent to target.
+	applied   bool
+	lastAngle int32
+}
+
+func NewDriver(p Policy, t Target, interval time.Duration) *Driver {
+	return &Driver{
+		policy:   p,
+		target:   t,
+		interval: interval,
+		pokeC:    make(chan interface{}, 1),
+	}
+}
+
+// SetEnabled turns auto mode on or off. Enabling auto mode discards manual
+// override.
+func (d *Driver) SetEnabled(enabled bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if enabled == d.enabled {
+		return
+	}
+	d.enabled = enabled
+	d.overridden = false
+	d.applied = false
+	d.poke()
+}
+
+func (d *Driver) Enabled() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.enabled
+}
+
+// Override notifies driver that user changed angle manually. Policy is
+// suspended until its next decision. Policy is not evaluated as it could
+// change its state, last evaluated decision is used instead.
+func (d *Driver) Override() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.enabled || !d.decided {
+		return
+	}
+	if !d.overridden {
+		fmt.Println("auto: Manual override until next policy change")
+	}
+	d.overridden = true
+	d.overrideSince = d.decision
+}
+
+func (d *Driver) poke() {
+	select {
+	case d.pokeC <- nil:
+	default:
+	}
+}
+
+// Run evaluates policy until context is cancelled. Should be started in a
+// separate goroutine.
+func (d *Driver) Run(ctx context.Context) {
+	t := time.NewTicker(d.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-d.pokeC:
+		}
+		d.apply(time.Now())
+	}
+}
+
+func (d *Driver) apply(now time.Time) {
+	if !d.Enabled() {
+		return
+	}
+	angle, since, ok := d.policy.Target(now)
+	if !ok {
+		return
+	}
+	if d.decide(angle, since) {
+		d.target.SetTarget(angle)
+	}
+}
+
+// decide records policy decision and returns true if angle should be sent
+// to target.
+func (d *Driver) decide(angle int32, since time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.enabled {
+		return false
+	}
+	d.decided = true
+	d.decision = since
+	if d.overridden {
+		if since.Equal(d.overrideSince) {
+			return false
+		}
+		fmt.Println("auto: Manual override ended")
+		d.overridden = false
+		d.applied = false
+	}
+	if d.applied && angle == d.lastAngle {
+		return false
+	}
+	d.applied = true
+	d.lastAngle = angle
+	return true
+}
@@ -0,0 +1,113 @@
+package auto
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aliher1911/blinds/sensor"
+)
+
+// LightConfig controls closing blinds in bright light.
+type LightConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Close blinds when light exceeds threshold in lux.
+	Threshold float32 `yaml:"threshold"`
+	// Open blinds when light drops below threshold by hysteresis lux.
+	Hysteresis float32 `yaml:"hysteresis"`
+	// Min time between changes to avoid moving on passing clouds.
+	MinDwell time.Duration `yaml:"min_dwell"`
+	// Shaft angle of closed blinds.
+	ClosedAngle int32 `yaml:"closed_angle"`
+	// Shaft angle of open blinds used when other policies have no opinion.
+	OpenAngle int32 `yaml:"open_angle"`
+}
+
+func LightDefaults() LightConfig {
+	return LightConfig{
+		Threshold:   20000,
+		Hysteresis:  5000,
+		MinDwell:    10 * time.Minute,
+		ClosedAngle: -140,
+		OpenAngle:   0,
+	}
+}
+
+// Light is a policy that closes blinds when ambient light is bright. In
+// dim light it defers to fallback policy.
+type Light struct {
+	cfg      LightConfig
+	sensor   sensor.LightSensor
+	fallback Policy
+
+	mu sync.Mutex
+	// No decision is made until first successful reading.
+	valid   bool
+	bright  bool
+	changed time.Time
+}
+
+func NewLight(cfg LightConfig, s sensor.LightSensor, fallback Policy) *Light {
+	return &Light{
+		cfg:      cfg,
+		sensor:   s,
+		fallback: fallback,
+	}
+}
+
+// Target returns closed angle while light is bright. Decision time is the
+// time light level last changed state.
+func (l *Light) Target(now time.Time) (int32, time.Time, bool) {
+	bright, changed, ok := l.update(now)
+	if !ok {
+		if l.fallback != nil {
+			return l.fallback.Target(now)
+		}
+		return 0, time.Time{}, false
+	}
+	if bright {
+		return l.cfg.ClosedAngle, changed, true
+	}
+	if l.fallback != nil {
+		if a, since, ok := l.fallback.Target(now); ok {
+			if since.Before(changed) {
+				since = changed
+			}
+			return a, since, true
+		}
+	}
+	return l.cfg.OpenAngle, changed, true
+}
+
+// update reads sensor and switches light state when reading crosses
+// threshold and state was held for min dwell time. Failed reads keep
+// current state.
+func (l *Light) update(now time.Time) (bool, time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lux, err := l.sensor.Lux()
+	if err != nil {
+		fmt.Printf("auto: Failed to read light sensor: %s\n", err)
+		return l.bright, l.changed, l.valid
+	}
+	if !l.valid {
+		l.valid = true
+		l.bright = lux > l.cfg.Threshold
+		l.changed = now
+		return l.bright, l.changed, true
+	}
+	if now.Sub(l.changed) < l.cfg.MinDwell {
+		return l.bright, l.changed, true
+	}
+	switch {
+	case !l.bright && lux > l.cfg.Threshold:
+		fmt.Printf("auto: Light level %.0f lx is above threshold\n", lux)
+		l.bright = true
+		l.changed = now
+	case l.bright && lux < l.cfg.Threshold-l.cfg.Hysteresis:
+		fmt.Printf("auto: Light level %.0f lx is below threshold\n", lux)
+		l.bright = false
+		l.changed = now
+	}
+	return l.bright, l.changed, true
+}
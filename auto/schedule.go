@@ -0,0 +1,197 @@
+package auto
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Clock is time of day with minute precision.
+type Clock int
+
+func ParseClock(s string) (Clock, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return Clock(t.Hour()*60 + t.Minute()), nil
+}
+
+func (c Clock) String() string {
+	return fmt.Sprintf("%02d:%02d", int(c)/60, int(c)%60)
+}
+
+func (c *Clock) UnmarshalYAML(n *yaml.Node) error {
+	v, err := ParseClock(n.Value)
+	if err != nil {
+		return err
+	}
+	*c = v
+	return nil
+}
+
+func (c Clock) MarshalYAML() (interface{}, error) {
+	return c.String(), nil
+}
+
+// Weekdays is a set of days of week. Empty set means every day.
+type Weekdays uint8
+
+const (
+	Weekends = Weekdays(1<<time.Saturday | 1<<time.Sunday)
+	Workdays = Weekdays(0x7f) &^ Weekends
+	Everyday = Weekdays(0x7f)
+)
+
+var dayNames = map[string]Weekdays{
+	"sun":      1 << time.Sunday,
+	"mon":      1 << time.Monday,
+	"tue":      1 << time.Tuesday,
+	"wed":      1 << time.Wednesday,
+	"thu":      1 << time.Thursday,
+	"fri":      1 << time.Friday,
+	"sat":      1 << time.Saturday,
+	"weekdays": Workdays,
+	"weekends": Weekends,
+	"daily":    Everyday,
+}
+
+// ParseWeekdays parses day names like "mon", groups "weekdays", "weekends",
+// "daily" and ranges like "mon-thu".
+func ParseWeekdays(names []string) (Weekdays, error) {
+	var w Weekdays
+	for _, n := range names {
+		n = strings.ToLower(strings.TrimSpace(n))
+		if from, to, ok := strings.Cut(n, "-"); ok {
+			f, fok := dayNames[from]
+			t, tok := dayNames[to]
+			if !fok || !tok || bits.OnesCount8(uint8(f)) != 1 || bits.OnesCount8(uint8(t)) != 1 {
+				return 0, fmt.Errorf("invalid day range %q", n)
+			}
+			for d := f; ; d = rotate(d) {
+				w |= d
+				if d == t {
+					break
+				}
+			}
+			continue
+		}
+		d, ok := dayNames[n]
+		if !ok {
+			return 0, fmt.Errorf("invalid day %q", n)
+		}
+		w |= d
+	}
+	return w, nil
+}
+
+// rotate moves single day set to the next day of week.
+func rotate(d Weekdays) Weekdays {
+	if d == 1<<time.Saturday {
+		return 1 << time.Sunday
+	}
+	return d << 1
+}
+
+func (w Weekdays) Has(d time.Weekday) bool {
+	return w == 0 || w&(1<<d) != 0
+}
+
+func (w Weekdays) String() string {
+	switch w {
+	case 0, Everyday:
+		return "daily"
+	case Workdays:
+		return "weekdays"
+	case Weekends:
+		return "weekends"
+	}
+	var days []string
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if w&(1<<d) != 0 {
+			days = append(days, strings.ToLower(d.String()[:3]))
+		}
+	}
+	return strings.Join(days, ",")
+}
+
+func (w *Weekdays) UnmarshalYAML(n *yaml.Node) error {
+	var names []string
+	if n.Kind == yaml.ScalarNode {
+		names = strings.Split(n.Value, ",")
+	} else if err := n.Decode(&names); err != nil {
+		return err
+	}
+	v, err := ParseWeekdays(names)
+	if err != nil {
+		return err
+	}
+	*w = v
+	return nil
+}
+
+func (w Weekdays) MarshalYAML() (interface{}, error) {
+	return w.String(), nil
+}
+
+// Rule sets blinds angle at time of day on given days of week.
+type Rule struct {
+	Days Weekdays `yaml:"days"`
+	// Required, nil if time is missing in config.
+	At *Clock `yaml:"at"`
+	// Shaft angle to set.
+	Angle int32 `yaml:"angle"`
+	// Time to gradually move from previous rule angle. Zero moves at once.
+	Transition time.Duration `yaml:"transition"`
+}
+
+// Schedule is a policy that sets angles according to time of day rules.
+type Schedule struct {
+	rules []Rule
+}
+
+func NewSchedule(rules []Rule) *Schedule {
+	return &Schedule{
+		rules: rules,
+	}
+}
+
+// Target returns angle of the rule that fired last before now. While rule
+// transition is in progress angle is interpolated from previous rule.
+func (s *Schedule) Target(now time.Time) (int32, time.Time, bool) {
+	r, at, ok := s.last(now)
+	if !ok {
+		return 0, time.Time{}, false
+	}
+	since := now.Sub(at)
+	if since >= r.Transition {
+		return r.Angle, at, true
+	}
+	prev, _, _ := s.last(at.Add(-time.Minute))
+	frac := float64(since) / float64(r.Transition)
+	return prev.Angle + int32(float64(r.Angle-prev.Angle)*frac), at, true
+}
+
+// last finds rule that fired last at or before t and time it fired.
+func (s *Schedule) last(t time.Time) (Rule, time.Time, bool) {
+	var best Rule
+	var bestAt time.Time
+	// Every rule fires at least once a week.
+	for days := 0; days <= 7; days++ {
+		y, m, d := t.AddDate(0, 0, -days).Date()
+		for _, r := range s.rules {
+			at := time.Date(y, m, d, int(*r.At)/60, int(*r.At)%60, 0, 0, t.Location())
+			if !r.Days.Has(at.Weekday()) || at.After(t) || !at.After(bestAt) {
+				continue
+			}
+			best, bestAt = r, at
+		}
+		if !bestAt.IsZero() {
+			return best, bestAt, true
+		}
+	}
+	return Rule{}, time.Time{}, false
+}
@@ -0,0 +1,160 @@
+package auto
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	deg = math.Pi / 180
+	// Julian date of unix epoch and J2000 epoch.
+	jdUnixEpoch = 2440587.5
+	jdJ2000     = 2451545.0
+)
+
+// SunPosition computes sun elevation above horizon and azimuth clockwise
+// from north in degrees for location at time t. It uses low precision
+// almanac formulas which are accurate to a fraction of degree and are more
+// than enough to position slats.
+func SunPosition(t time.Time, lat, lon float64) (elevation, azimuth float64) {
+	jd := float64(t.UnixNano())/float64(24*time.Hour) + jdUnixEpoch
+	n := jd - jdJ2000
+
+	// Ecliptic coordinates.
+	l := math.Mod(280.460+0.9856474*n, 360)
+	g := math.Mod(357.528+0.9856003*n, 360) * deg
+	lambda := (l + 1.915*math.Sin(g) + 0.020*math.Sin(2*g)) * deg
+	eps := (23.439 - 0.0000004*n) * deg
+
+	// Equatorial coordinates.
+	ra := math.Atan2(math.Cos(eps)*math.Sin(lambda), math.Cos(lambda))
+	dec := math.Asin(math.Sin(eps) * math.Sin(lambda))
+
+	// Local hour angle from sidereal time.
+	gmst := math.Mod(18.697374558+24.06570982441908*n, 24)
+	ha := (gmst*15+lon)*deg - ra
+
+	phi := lat * deg
+	elevation = math.Asin(math.Sin(phi)*math.Sin(dec) + math.Cos(phi)*math.Cos(dec)*math.Cos(ha))
+	azimuth = math.Atan2(-math.Sin(ha)*math.Cos(dec), math.Sin(dec)*math.Cos(phi)-math.Cos(dec)*math.Sin(phi)*math.Cos(ha))
+	azimuth = math.Mod(azimuth/deg+360, 360)
+	return elevation / deg, azimuth
+}
+
+// SunConfig describes window and slats geometry for sun tracking.
+type SunConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Location in degrees, north and east are positive.
+	Latitude  float64 `yaml:"latitude"`
+	Longitude float64 `yaml:"longitude"`
+	// Direction window faces clockwise from north in degrees, 180 is south.
+	WindowAzimuth float64 `yaml:"window_azimuth"`
+	// Distance between slats divided by slat width.
+	SlatRatio float64 `yaml:"slat_ratio"`
+	// Shaft rotation per degree of slat tilt. Sign selects shaft direction
+	// that lowers outer edge of slats.
+	ShaftPerSlat float64 `yaml:"shaft_per_slat"`
+	// Shaft angle used when sun is not shining into window and schedule has
+	// no rules.
+	Angle int32 `yaml:"angle"`
+}
+
+func SunDefaults() SunConfig {
+	return SunConfig{
+		WindowAzimuth: 180,
+		SlatRatio:     0.85,
+		ShaftPerSlat:  1.5,
+	}
+}
+
+// Step used to search for the time when sun entered or left window.
+const sunSearchStep = 5 * time.Minute
+
+// Sun is a policy that tilts slats just enough to block direct sunlight
+// while sun is shining into window. Otherwise it defers to fallback policy.
+type Sun struct {
+	cfg      SunConfig
+	fallback Policy
+
+	mu sync.Mutex
+	// Cached start of current phase to avoid searching on every call.
+	shining   bool
+	lastSeen  time.Time
+	lastStart time.Time
+}
+
+func NewSun(cfg SunConfig, fallback Policy) *Sun {
+	return &Sun{
+		cfg:      cfg,
+		fallback: fallback,
+	}
+}
+
+// Target returns cut off angle for current sun position. Decision time is
+// the time sun entered window so manual changes last until sun leaves it.
+func (s *Sun) Target(now time.Time) (int32, time.Time, bool) {
+	elevation, azimuth := SunPosition(now, s.cfg.Latitude, s.cfg.Longitude)
+	rel, shining := s.relative(elevation, azimuth)
+	if !shining && s.fallback != nil {
+		if a, since, ok := s.fallback.Target(now); ok {
+			return a, since, true
+		}
+	}
+	since := s.phaseStart(now, shining)
+	if !shining {
+		return s.cfg.Angle, since, true
+	}
+	return s.cutOff(elevation, rel), since, true
+}
+
+// relative returns sun azimuth relative to window normal and whether sun is
+// above horizon in front of window.
+func (s *Sun) relative(elevation, azimuth float64) (float64, bool) {
+	rel := math.Mod(azimuth-s.cfg.WindowAzimuth+540, 360) - 180
+	return rel, elevation > 0 && math.Abs(rel) < 90
+}
+
+func (s *Sun) shiningAt(t time.Time) bool {
+	_, ok := s.relative(SunPosition(t, s.cfg.Latitude, s.cfg.Longitude))
+	return ok
+}
+
+// cutOff computes shaft angle at which slats block direct sun. Sun position
+// is projected on the plane perpendicular to window and slats are tilted
+// so that ray passing outer edge of upper slat hits inner edge of the lower
+// one.
+func (s *Sun) cutOff(elevation, rel float64) int32 {
+	profile := math.Atan(math.Tan(elevation*deg) / math.Cos(rel*deg))
+	tilt := math.Asin(math.Min(1, s.cfg.SlatRatio*math.Cos(profile))) - profile
+	return int32(math.Round(tilt / deg * s.cfg.ShaftPerSlat))
+}
+
+// phaseStart finds time with minute precision when sun last entered or left
+// window.
+func (s *Sun) phaseStart(now time.Time, shining bool) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.lastSeen.IsZero() && s.shining == shining && !now.Before(s.lastSeen) && now.Sub(s.lastSeen) < sunSearchStep {
+		s.lastSeen = now
+		return s.lastStart
+	}
+	// Phase that lasts over a day (polar day or night) has no start.
+	var start time.Time
+	t := now.Truncate(time.Minute)
+	for back := time.Duration(0); back < 24*time.Hour; back += sunSearchStep {
+		if s.shiningAt(t.Add(-back)) == shining {
+			continue
+		}
+		// Refine within last search step.
+		start = t.Add(-back + time.Minute)
+		for s.shiningAt(start) != shining {
+			start = start.Add(time.Minute)
+		}
+		break
+	}
+	s.shining = shining
+	s.lastSeen = now
+	s.lastStart = start
+	return start
+}
@@ -0,0 +1,238 @@
+package cli
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/aliher1911/blinds/actuator"
+	"github.com/aliher1911/blinds/config"
+	"github.com/aliher1911/blinds/input"
+	"github.com/aliher1911/blinds/sensor"
+)
+
+// Shaft rotation per encoder click while calibrating. It is finer than
+// UI step to allow precise positioning.
+const calibrationClick = 2
+
+// Delay between steps while moving shaft in calibration.
+const calibrationStepDelay = time.Millisecond
+
+// Speed and duration of DC motor run per degree of calibration click.
+const calibrationJogSpeed = 0.5
+const calibrationJogTime = 30 * time.Millisecond
+
+// How often controls are polled while waiting for user input.
+const calibrationPoll = 50 * time.Millisecond
+
+// Number of sensor readings averaged for every calibration point.
+const calibrationReads = 5
+
+// Minimum range between fully closed and open positions that we accept.
+const minCalibrationRange = 30
+
+type calibrationPoint struct {
+	name  string
+	color input.Color
+	// Raw sensor angle without base applied.
+	angle float64
+	// Stepper position. For DC motors it is degrees of commanded rotation.
+	pos int64
+}
+
+// Calibrate walks user through moving slats to closed, horizontal and open
+// positions using rotary and writes computed base angle, angle limits and
+// steps per degree to config file.
+func Calibrate(hw Hardware, cfg config.Config, path string, sigs <-chan os.Signal) {
+	if path == "" {
+		fmt.Println("calibration requires config file path to save results")
+		return
+	}
+
+	m, err := hw.Magnetometer()
+	if err != nil {
+		fmt.Printf("failed to init magnetometer: %s\n", err)
+		return
+	}
+	defer m.Close()
+
+	r, err := hw.Rotary()
+	if err != nil {
+		fmt.Printf("failed to init rotatore: %s\n", err)
+		return
+	}
+	defer r.Close()
+	defer r.LED(input.Off)
+
+	s, err := hw.Stepper()
+	if err != nil {
+		fmt.Printf("failed to init stepper: %s\n", err)
+		return
+	}
+	defer s.PowerOff()
+	// Config steps are half steps, motor steps could be larger or smaller.
+	stepSize := s.Capabilities().StepScale()
+
+	p := sensor.NewPositionSensor(m, 0)
+	points := []calibrationPoint{
+		{name: "fully closed", color: input.Blue},
+		{name: "horizontal", color: input.White},
+		{name: "fully open", color: input.Green},
+	}
+
+	// Clicks turn shaft in the same direction as they do in UI.
+	click := int32(calibrationClick)
+	if cfg.UI.ClickAngle < 0 {
+		click = -click
+	}
+	var pos int64
+	// Reset accumulated rotation and button state.
+	r.Delta()
+	pressed, _, _ := r.Button()
+	for i := range points {
+		pt := &points[i]
+		fmt.Printf("calibrate: rotate knob to move slats to %s position and press button\n", pt.name)
+		r.LED(pt.color.Scale(0.3))
+	wait_press:
+		for {
+			select {
+			case <-sigs:
+				fmt.Println("calibrate: aborted, config is not changed")
+				return
+			case <-time.After(calibrationPoll):
+			}
+			if d, err := r.Delta(); err != nil {
+				fmt.Printf("calibrate: failed to read rotary: %s\n", err)
+			} else if d != 0 {
+				// Stepping forward decreases angle.
+				if dc, ok := s.(actuator.SpeedMotor); ok {
+					pos += jog(dc, -int64(int32(d)*click))
+				} else {
+					steps := int64(-float64(int32(d)*click) * cfg.Controller.StepsPerDegree / stepSize)
+					pos += move(s, steps)
+				}
+			}
+			b, _, err := r.Button()
+			if err != nil {
+				fmt.Printf("calibrate: failed to read button: %s\n", err)
+				continue
+			}
+			if b && !pressed {
+				pressed = b
+				break wait_press
+			}
+			pressed = b
+		}
+
+		a, err := averageAngle(p)
+		if err != nil {
+			fmt.Printf("calibrate: failed to read sensor: %s\n", err)
+			return
+		}
+		pt.angle, pt.pos = a, pos
+		fmt.Printf("calibrate: %s position is at sensor angle %.1f\n", pt.name, a)
+		r.LED(pt.color)
+	}
+
+	closed, horizontal, open := points[0], points[1], points[2]
+	rel := func(a float64) float64 {
+		return wrapAngle(a - horizontal.angle)
+	}
+	lo, hi := rel(closed.angle), rel(open.angle)
+	if math.Abs(hi-lo) < minCalibrationRange {
+		fmt.Printf("calibrate: range between closed and open positions %.1f is too small\n", math.Abs(hi-lo))
+		return
+	}
+	spd := -float64(open.pos-closed.pos) * stepSize / (hi - lo)
+	if spd <= 0 {
+		fmt.Println("calibrate: shaft rotates against stepper direction, check stepper wiring")
+		return
+	}
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+
+	// Reload file to keep command line overrides out of it.
+	saved, err := config.Load(path)
+	if err != nil {
+		fmt.Printf("calibrate: failed to reload config: %s\n", err)
+		return
+	}
+	saved.BaseAngle = int32(math.Round(horizontal.angle))
+	saved.Controller.MinAngle = int32(math.Ceil(lo))
+	saved.Controller.MaxAngle = int32(math.Floor(hi))
+	// DC motor position is only used to check direction.
+	if _, ok := s.(actuator.SpeedMotor); !ok {
+		saved.Controller.StepsPerDegree = math.Round(spd*10) / 10
+	}
+	saved.UI.MinAngle = saved.Controller.MinAngle
+	saved.UI.MaxAngle = saved.Controller.MaxAngle
+	saved.Propagate()
+	fmt.Printf("calibrate: base angle %d, angle range [%d, %d], %.1f steps per degree\n",
+		saved.BaseAngle, saved.Controller.MinAngle, saved.Controller.MaxAngle, saved.Controller.StepsPerDegree)
+	if err := saved.Validate(); err != nil {
+		fmt.Printf("calibrate: calibration produced invalid config: %s\n", err)
+		return
+	}
+	if err := saved.Save(path); err != nil {
+		fmt.Printf("calibrate: failed to save config: %s\n", err)
+		return
+	}
+	fmt.Printf("calibrate: saved config to %s\n", path)
+}
+
+// jog runs DC motor for time proportional to degrees and returns degrees.
+func jog(m actuator.SpeedMotor, degrees int64) int64 {
+	speed, t := calibrationJogSpeed, time.Duration(degrees)*calibrationJogTime
+	if degrees < 0 {
+		speed, t = -speed, -t
+	}
+	m.Drive(speed)
+	<-time.After(t)
+	m.Drive(0)
+	return degrees
+}
+
+// move rotates stepper by number of steps and returns steps made.
+func move(s actuator.Motor, steps int64) int64 {
+	dir := 1
+	if steps < 0 {
+		dir = -1
+	}
+	for i := int64(0); i != steps; i += int64(dir) {
+		s.Step(dir)
+		<-time.After(calibrationStepDelay)
+	}
+	return steps
+}
+
+// averageAngle reads sensor multiple times and averages readings as
+// vectors to avoid problems around ±180.
+func averageAngle(p sensor.AngleSensor) (float64, error) {
+	var x, y float64
+	for i := 0; i < calibrationReads; i++ {
+		r, err := p.Read()
+		if err != nil {
+			return 0, err
+		}
+		if r.Quality == 0 {
+			return 0, fmt.Errorf("no magnetic field detected")
+		}
+		a := float64(r.Angle) * math.Pi / 180
+		x += math.Cos(a)
+		y += math.Sin(a)
+		<-time.After(calibrationPoll)
+	}
+	return math.Atan2(y, x) * 180 / math.Pi, nil
+}
+
+func wrapAngle(a float64) float64 {
+	switch {
+	case a > 180:
+		return a - 360
+	case a < -180:
+		return a + 360
+	}
+	return a
+}
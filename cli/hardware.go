@@ -0,0 +1,145 @@
+package cli
+
+import (
+	"os"
+	"sync"
+
+	"github.com/aliher1911/blinds/actuator"
+	"github.com/aliher1911/blinds/config"
+	i2cdev "github.com/aliher1911/blinds/i2c"
+	"github.com/aliher1911/blinds/input"
+	"github.com/aliher1911/blinds/sensor"
+	"github.com/aliher1911/blinds/sim"
+
+	"github.com/stianeikeland/go-rpio/v4"
+)
+
+// Hardware creates devices used by commands.
+type Hardware interface {
+	Stepper() (actuator.Motor, error)
+	Magnetometer() (Magnetometer, error)
+	Rotary() (input.Control, error)
+	LightSensor() (LightSensor, error)
+	// IntPin is the interrupt line of the rotary.
+	IntPin() i2cdev.Interrupt
+}
+
+type Magnetometer interface {
+	sensor.Field
+	Close()
+}
+
+type LightSensor interface {
+	sensor.LightSensor
+	Close()
+}
+
+// devices is hardware connected to GPIO and I2C bus. GPIO must be opened
+// before creating devices.
+type devices struct {
+	cfg config.Config
+}
+
+func NewDevices(cfg config.Config) Hardware {
+	return devices{cfg: cfg}
+}
+
+func (d devices) Stepper() (actuator.Motor, error) {
+	return actuator.NewMotor(d.cfg.Stepper)
+}
+
+func (d devices) Magnetometer() (Magnetometer, error) {
+	m, err := sensor.NewMagnetometer(d.cfg.Magnetometer)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (d devices) Rotary() (input.Control, error) {
+	r, err := input.NewRotary(d.cfg.Rotary)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (d devices) LightSensor() (LightSensor, error) {
+	l, err := sensor.NewBH1750(d.cfg.LightSensor)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (d devices) IntPin() i2cdev.Interrupt {
+	return i2cdev.NewIntPin(d.cfg.IntPin, rpio.FallEdge)
+}
+
+// simulator is a software model of blinds. Rotary is controlled by
+// commands from stdin.
+type simulator struct {
+	cfg   sim.Config
+	motor actuator.Config
+	b     *sim.Blinds
+	r     *sim.Rotary
+	l     *sim.Light
+	// DC motor if configured. It is shared by motor and sensor to advance
+	// motion on reads.
+	dc      *sim.DCMotor
+	console sync.Once
+}
+
+// NewSimulator creates simulator. TMC2209 motor driver is simulated with
+// a register model, DC motor is simulated by speed and other drivers are
+// replaced by simulated stepper.
+func NewSimulator(cfg sim.Config, motor actuator.Config) Hardware {
+	s := &simulator{
+		cfg:   cfg,
+		motor: motor,
+		b:     sim.NewBlinds(cfg),
+		r:     sim.NewRotary(),
+		l:     sim.NewLight(cfg.Lux),
+	}
+	if motor.Driver == actuator.DriverDC {
+		s.dc = sim.NewDCMotor(s.b, cfg)
+	}
+	return s
+}
+
+func (s *simulator) Stepper() (actuator.Motor, error) {
+	switch s.motor.Driver {
+	case actuator.DriverDC:
+		return s.dc, nil
+	case actuator.DriverTMC2209:
+		cfg := s.motor.TMC2209
+		// Simulated motor steps are half steps and there are no GPIO pins.
+		cfg.Microsteps = 2
+		cfg.DiagPin = -1
+		cfg.Echo = true
+		return actuator.NewTMC2209(cfg, sim.NewTMC2209(cfg.Addr, s.b.Blocked), s.b)
+	}
+	return s.b, nil
+}
+
+func (s *simulator) Magnetometer() (Magnetometer, error) {
+	if s.dc != nil {
+		return s.dc, nil
+	}
+	return s.b, nil
+}
+
+func (s *simulator) Rotary() (input.Control, error) {
+	s.console.Do(func() {
+		go sim.RunConsole(os.Stdin, s.r, s.l)
+	})
+	return s.r, nil
+}
+
+func (s *simulator) LightSensor() (LightSensor, error) {
+	return s.l, nil
+}
+
+func (s *simulator) IntPin() i2cdev.Interrupt {
+	return s.r.IntPin()
+}
@@ -6,42 +6,71 @@ import (
 	"math"
 	"os"
 	"sync"
+	"time"
 
-	"github.com/aliher1911/blinds/actuator"
+	"github.com/aliher1911/blinds/api"
+	"github.com/aliher1911/blinds/auto"
+	"github.com/aliher1911/blinds/config"
 	"github.com/aliher1911/blinds/controller"
+	"github.com/aliher1911/blinds/hass"
 	"github.com/aliher1911/blinds/input"
 	"github.com/aliher1911/blinds/sensor"
+	"github.com/aliher1911/blinds/state"
 	"github.com/aliher1911/blinds/ui"
 )
 
-func Service(bus uint, baseAngle int32, sigs <-chan os.Signal) {
+func Service(hw Hardware, cfg config.Config, sigs <-chan os.Signal) {
 	var wg sync.WaitGroup
 	defer wg.Wait()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	s := actuator.NewStepper(actuator.DefaultPins)
+	s, err := hw.Stepper()
+	if err != nil {
+		fmt.Printf("failed to init stepper: %s\n", err)
+		return
+	}
 	defer s.PowerOff()
 
-	m, err := sensor.NewMagnetometer(sensor.Default(bus))
+	m, err := hw.Magnetometer()
 	if err != nil {
 		fmt.Printf("failed to init magnetometer: %s\n", err)
 		return
 	}
 	defer m.Close()
 
-	r, err := input.NewRotary(input.Default(bus))
+	r, err := hw.Rotary()
 	if err != nil {
 		fmt.Printf("failed to init rotatore: %s\n", err)
 		return
 	}
 	defer r.Close()
 
-	ccfg := controller.Defaults()
-	ccfg.IntPin = int_pin
-	p := sensor.NewPositionSensor(m, float32(baseAngle))
-	ctrl := controller.NewController(&s, &p, ccfg)
+	var light LightSensor
+	if cfg.Auto.Light.Enabled {
+		if light, err = hw.LightSensor(); err != nil {
+			fmt.Printf("failed to init light sensor: %s\n", err)
+			return
+		}
+		defer light.Close()
+	}
+
+	st := state.Empty()
+	if cfg.StateFile != "" {
+		if st, err = state.Load(cfg.StateFile); err != nil {
+			fmt.Printf("service: ignoring saved state: %s\n", err)
+		}
+	}
+	cc := cfg.Controller
+	if cc.LearnStepsPerDegree && st.StepsPerDegree > 0 && st.CalibratedStepsPerDegree == cc.StepsPerDegree {
+		// Continue learning from saved value unless blinds were recalibrated.
+		cc.StepsPerDegree = st.StepsPerDegree
+	}
+
+	p := sensor.NewPositionSensor(m, float32(cfg.BaseAngle))
+	ctrl := controller.NewController(s, p, cc)
+	ctrl.PollInterrupts(hw.IntPin())
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -55,50 +84,337 @@ func Service(bus uint, baseAngle int32, sigs <-chan os.Signal) {
 		l.Run(ctx)
 	}()
 
-	a := &DocAdapter{ctrl: ctrl}
-	ui := ui.New(r, ctrl.InterruptC(), lC, a)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		showStatus(ctx, ctrl, cfg.UI, lC)
+	}()
+
+	var policy auto.Policy = auto.NewSchedule(cfg.Auto.Schedule)
+	if cfg.Auto.Sun.Enabled {
+		policy = auto.NewSun(cfg.Auto.Sun, policy)
+	}
+	if light != nil {
+		policy = auto.NewLight(cfg.Auto.Light, light, policy)
+	}
+	d := auto.NewDriver(policy, ctrl, cfg.Auto.Interval)
+	d.SetEnabled(st.Auto)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		d.Run(ctx)
+	}()
+
+	a := &DocAdapter{ctrl: ctrl, driver: d, settings: st.UI}
+	if cfg.StateFile != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			saveState(ctx, cfg.StateFile, st, cfg.Controller.StepsPerDegree, cc.StepsPerDegree, ctrl, a)
+		}()
+	}
+	restore := st.UI != (ui.Settings{})
+	ui := ui.New(r, ctrl.InterruptC(), lC, deviceAdapter{a}, cfg.UI)
+	if restore {
+		if err := ui.Restore(st.UI); err != nil {
+			fmt.Printf("service: ignoring saved ui settings: %s\n", err)
+		} else {
+			ctrl.SetLimits(st.UI.MinAngle, st.UI.MaxAngle)
+		}
+	}
+	// Restored target must respect restored limits.
+	if st.Target != controller.NoAngle {
+		fmt.Printf("service: restoring target %d\n", st.Target)
+		ctrl.SetTarget(st.Target)
+	}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		ui.Run(ctx)
 	}()
 
+	if cfg.HTTPAddr != "" {
+		srv := api.New(cfg.HTTPAddr, a)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := srv.Run(ctx); err != nil && err != context.Canceled {
+				fmt.Printf("service: api server failed: %s\n", err)
+			}
+		}()
+	}
+
+	if cfg.MQTT.Broker != "" {
+		hc := hass.New(cfg.MQTT, a)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hc.Run(ctx)
+		}()
+	}
+
 	<-sigs
 	fmt.Println("service: Received interrupt signal. Aborting.")
+	if cfg.Controller.LearnStepsPerDegree {
+		fmt.Printf("service: learned %.1f steps per degree\n", ctrl.LearnedStepsPerDegree())
+	}
 
 	r.LED(input.Off)
 }
 
+const (
+	// How often status is checked in case events were dropped.
+	statusCheckT = 3 * time.Second
+	// Blink period, count and pause between blinks of fault indication.
+	faultBlinkT     = 500 * time.Millisecond
+	faultBlinkCount = 3
+	faultPause      = 2 * time.Second
+	// Period of pulse while moving.
+	movePulseT = time.Second
+	// Duration of arrival flash.
+	arrivedT = 600 * time.Millisecond
+)
+
+type ledStatus int
+
+const (
+	ledIdle ledStatus = iota
+	ledMoving
+	ledSafetyStop
+)
+
+// showStatus indicates controller state on LED. Moving shaft pulses with
+// color sweeping from current to target angle color, arrival flashes green,
+// safety stop shows amber and fault blinks red over everything else.
+func showStatus(ctx context.Context, ctrl *controller.Controller, cfg ui.Config, lC chan<- *input.LedOp) {
+	events, cancel := ctrl.Subscribe()
+	defer cancel()
+	t := time.NewTicker(statusCheckT)
+	defer t.Stop()
+
+	faulted := false
+	shown := ledIdle
+	shownAngle := int32(controller.NoAngle)
+	send := func(op *input.LedOp) bool {
+		select {
+		case lC <- op:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	update := func(s controller.Status, arrived bool) bool {
+		if f := s.Fault != nil; f != faulted {
+			faulted = f
+			op := input.Clear(input.LayerAlert)
+			if f {
+				op = input.Play(input.LayerAlert, input.Loop(input.Sequence(
+					input.Blink(input.Red, faultBlinkCount, faultBlinkT),
+					input.Solid(input.Off, faultPause)), 0))
+			}
+			if !send(op) {
+				return false
+			}
+		}
+		switch {
+		case s.SafetyStop:
+			if shown == ledSafetyStop {
+				return true
+			}
+			shown = ledSafetyStop
+			return send(input.Play(input.LayerStatus, input.Solid(input.Amber, input.Forever)))
+		case arrived:
+			shown = ledIdle
+			return send(input.Play(input.LayerStatus, input.Blink(input.Green, 1, 2*arrivedT)))
+		case s.Moving && s.Angle != controller.NoAngle:
+			if shown == ledMoving && s.Angle == shownAngle {
+				return true
+			}
+			shown, shownAngle = ledMoving, s.Angle
+			from, to := cfg.AngleColor(s.Angle), cfg.AngleColor(s.Target)
+			return send(input.Play(input.LayerStatus, input.Loop(input.Sequence(
+				input.Fade(input.Off, from, movePulseT/4, input.EaseInOut),
+				input.Fade(from, to, movePulseT/4, input.Linear),
+				input.Fade(to, input.Off, movePulseT/2, input.EaseInOut)), 0)))
+		case shown != ledIdle:
+			shown = ledIdle
+			return send(input.Clear(input.LayerStatus))
+		}
+		return true
+	}
+	if !update(ctrl.Status(), false) {
+		return
+	}
+	for {
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-events:
+			ok = update(e.Status, e.Type == controller.TargetReached)
+		case <-t.C:
+			ok = update(ctrl.Status(), false)
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+const (
+	// How often state is checked for changes to save.
+	stateSaveT = 5 * time.Second
+	// Relative change of learned steps per degree worth saving.
+	stateSaveStepsChange = 0.01
+)
+
+// saveState writes state file when target, mode or learned steps per degree
+// change and once more on exit. Target is only saved once controller
+// settles to avoid writing file on every UI click. Steps per degree are only
+// saved once controller learned value different from initial one.
+func saveState(ctx context.Context, path string, saved state.State, calibrated, initial float64, ctrl *controller.Controller, a *DocAdapter) {
+	events, cancel := ctrl.Subscribe()
+	defer cancel()
+	t := time.NewTicker(stateSaveT)
+	defer t.Stop()
+
+	save := func() {
+		cs := ctrl.Status()
+		st := saved
+		if cs.Target != controller.NoAngle && cs.AtTarget {
+			st.Target = cs.Target
+		}
+		// Adapter state is empty until position is known, ask driver directly.
+		st.Auto = a.driver.Enabled()
+		st.UI = a.Settings()
+		learned := cs.StepsPerDegree != initial
+		if ctrl.LearnStepsPerDegree && learned && math.Abs(cs.StepsPerDegree-st.StepsPerDegree) > st.StepsPerDegree*stateSaveStepsChange {
+			st.StepsPerDegree = cs.StepsPerDegree
+			st.CalibratedStepsPerDegree = calibrated
+		}
+		if st == saved {
+			return
+		}
+		if err := st.Save(path); err != nil {
+			fmt.Printf("service: failed to save state: %s\n", err)
+			return
+		}
+		saved = st
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			save()
+			return
+		case e := <-events:
+			if e.Type != controller.TargetReached {
+				continue
+			}
+		case <-t.C:
+		}
+		save()
+	}
+}
+
+// DocAdapter exposes controller to UI and remote APIs. It only accepts
+// changes once shaft position is known.
 type DocAdapter struct {
-	ctrl        *controller.Controller
+	ctrl   *controller.Controller
+	driver *auto.Driver
+
+	mu          sync.Mutex
 	initialized bool
+	// Initial target used until anything is set on controller.
+	initTarget int32
+	// Settings changed from UI menu.
+	settings ui.Settings
 }
 
+// SetAngle moves blinds to angle. Auto mode applies its next decision
+// over it.
 func (a *DocAdapter) SetAngle(angle int32) {
-	if a.initialized {
+	if a.Ready() {
+		a.ctrl.SetTarget(angle)
+	}
+}
+
+// deviceAdapter is document controlled from device rotary. Angles set on
+// device suspend auto mode until next policy decision.
+type deviceAdapter struct {
+	*DocAdapter
+}
+
+func (a deviceAdapter) SetAngle(angle int32) {
+	if a.Ready() {
+		a.driver.Override()
 		a.ctrl.SetTarget(angle)
 	}
 }
 
 func (a *DocAdapter) SetAuto(auto bool) {
+	a.driver.SetEnabled(auto)
+}
+
+// SetSettings keeps settings changed from UI menu to be saved in state and
+// applies angle limits to controller.
+func (a *DocAdapter) SetSettings(s ui.Settings) {
+	a.ctrl.SetLimits(s.MinAngle, s.MaxAngle)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.settings = s
+}
+
+func (a *DocAdapter) Limits() (int32, int32) {
+	return a.ctrl.Limits()
+}
+
+func (a *DocAdapter) Settings() ui.Settings {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.settings
+}
+
+// Stop interrupts current movement.
+func (a *DocAdapter) Stop() {
+	if a.Ready() {
+		a.ctrl.Stop()
+	}
+}
+
+// Ready is true once shaft position is known.
+func (a *DocAdapter) Ready() bool {
+	a.GetState()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.initialized
 }
 
 func (a *DocAdapter) GetState() ui.State {
-	ct := a.ctrl.Target()
-	pos := a.ctrl.Pos()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	st := a.ctrl.Status()
+	ct, pos := st.Target, st.Angle
 	if !a.initialized {
 		if pos == controller.NoAngle {
-			ct = 0
-			pos = 0
-		} else {
-			a.initialized = true
-			// Round current angle to closest 10 degree step.
-			ct = int32(math.Round(float64(pos)/10)) * 10
+			return ui.State{}
 		}
+		a.initialized = true
+		// Round current angle to closest 10 degree step.
+		a.initTarget = int32(math.Round(float64(pos)/10)) * 10
+	}
+	atTarget := st.AtTarget
+	if ct == controller.NoAngle {
+		// Nothing was requested yet so controller is idle.
+		ct = a.initTarget
+		atTarget = true
 	}
 	return ui.State{
 		SetAngle:     ct,
 		CurrentAngle: pos,
-		Auto:         false,
+		AtTarget:     atTarget,
+		Fault:        st.Fault,
+		Auto:         a.driver.Enabled(),
+		Ready:        true,
 	}
 }
@@ -7,22 +7,18 @@ import (
 	"os"
 	"time"
 
-	"github.com/aliher1911/blinds/actuator"
+	"github.com/aliher1911/blinds/config"
 	"github.com/aliher1911/blinds/controller"
 	i2cdev "github.com/aliher1911/blinds/i2c"
 	"github.com/aliher1911/blinds/input"
 	"github.com/aliher1911/blinds/sensor"
 	"github.com/aliher1911/blinds/ui"
-
-	"github.com/stianeikeland/go-rpio/v4"
 )
 
-const int_pin = 4
-
 const logTimeFmt = "15:04:05.999999999"
 
-func GetAngle(bus uint) {
-	m, err := sensor.NewMagnetometer(sensor.Default(bus))
+func GetAngle(hw Hardware) {
+	m, err := hw.Magnetometer()
 	if err != nil {
 		fmt.Printf("failed to init magnetometer: %s\n", err)
 		return
@@ -30,31 +26,34 @@ func GetAngle(bus uint) {
 	defer m.Close()
 	p := sensor.NewPositionSensor(m, 0)
 	for i := 0; i < 5; i++ {
-		a, err := p.Read()
+		r, err := p.Read()
 		if err != nil {
 			fmt.Printf("failed to read position value\n")
 		} else {
-			fmt.Printf("current angle is %f\n", a)
+			fmt.Printf("current angle is %f (quality %.2f)\n", r.Angle, r.Quality)
 		}
 		<-time.After(time.Second)
 	}
 }
 
-func SetAngle(bus uint, base, angle int32) {
-	fmt.Printf("Set angle to %d with base %d\n", angle, base)
+func SetAngle(hw Hardware, cfg config.Config, angle int32) {
+	fmt.Printf("Set angle to %d with base %d\n", angle, cfg.BaseAngle)
 
-	m, err := sensor.NewMagnetometer(sensor.Default(bus))
+	m, err := hw.Magnetometer()
 	if err != nil {
 		fmt.Printf("failed to init magnetometer: %s\n", err)
 		return
 	}
 	defer m.Close()
-	s := actuator.NewStepper(actuator.DefaultPins)
+	s, err := hw.Stepper()
+	if err != nil {
+		fmt.Printf("failed to init stepper: %s\n", err)
+		return
+	}
 	defer s.PowerOff()
 
-	ccfg := controller.Defaults()
-	p := sensor.NewPositionSensor(m, float32(base))
-	ctrl := controller.NewController(&s, &p, ccfg)
+	p := sensor.NewPositionSensor(m, float32(cfg.BaseAngle))
+	ctrl := controller.NewController(s, p, cfg.Controller)
 	go ctrl.Run(context.Background())
 	ctrl.SetTarget(angle)
 
@@ -91,7 +90,7 @@ func logInterrupts(t time.Time, count int) bool {
 	return true
 }
 
-func intDetector(ctx context.Context, c chan<- time.Time, pin i2cdev.IntPin) {
+func intDetector(ctx context.Context, c chan<- time.Time, pin i2cdev.Interrupt) {
 	var count, tick int
 	t := time.NewTicker(20 * time.Millisecond)
 	defer t.Stop()
@@ -120,8 +119,8 @@ var colorSeq = []input.Color{
 	input.Red, input.Green, input.Blue, input.White,
 }
 
-func CliTest(bus uint, sigs <-chan os.Signal) {
-	intPin := i2cdev.NewIntPin(int_pin, rpio.FallEdge)
+func CliTest(hw Hardware, sigs <-chan os.Signal) {
+	intPin := hw.IntPin()
 
 	// Close int routines before stopping gpio.
 	ctx, cancel := context.WithCancel(context.Background())
@@ -130,14 +129,14 @@ func CliTest(bus uint, sigs <-chan os.Signal) {
 	go intDetector(ctx, intC, intPin)
 	go handleInterrupts(ctx, intC, logInterrupts)
 
-	m, err := sensor.NewMagnetometer(sensor.Default(bus))
+	m, err := hw.Magnetometer()
 	if err != nil {
 		fmt.Printf("failed to init magnetometer: %s\n", err)
 		return
 	}
 	defer m.Close()
 
-	r, err := input.NewRotary(input.Default(bus))
+	r, err := hw.Rotary()
 	if err != nil {
 		fmt.Printf("failed to init rotatore: %s\n", err)
 		return
@@ -181,10 +180,10 @@ func CliTest(bus uint, sigs <-chan os.Signal) {
 	}
 }
 
-func IntDebug(bus uint, sigs <-chan os.Signal) {
-	intPin := i2cdev.NewIntPin(int_pin, rpio.FallEdge)
+func IntDebug(hw Hardware, sigs <-chan os.Signal) {
+	intPin := hw.IntPin()
 
-	r, err := input.NewRotary(input.Default(bus))
+	r, err := hw.Rotary()
 	if err != nil {
 		fmt.Printf("failed to init rotatore: %s\n", err)
 		return
@@ -225,8 +224,8 @@ func randChoice[T any](choice []T) T {
 	return choice[rand.Intn(len(choice))]
 }
 
-func LEDDemo(bus uint, sigs <-chan os.Signal) {
-	r, err := input.NewRotary(input.Default(bus))
+func LEDDemo(hw Hardware, sigs <-chan os.Signal) {
+	r, err := hw.Rotary()
 	if err != nil {
 		fmt.Printf("failed to init rotatore: %s\n", err)
 		return
@@ -253,16 +252,30 @@ func LEDDemo(bus uint, sigs <-chan os.Signal) {
 			return
 		case <-t.C:
 			d := randChoice(tChoice)
-			fmt.Printf("Pushing seq with delay %s\n", d)
-			lC <- input.NewLedOp(randChoice(cChoice), d,
-				input.NewLedOp(randChoice(cChoice), d),
-				input.NewLedOp(randChoice(cChoice), d))
+			switch rand.Intn(4) {
+			case 0:
+				fmt.Printf("Pushing seq with delay %s\n", d)
+				lC <- input.NewLedOp(randChoice(cChoice), d,
+					input.NewLedOp(randChoice(cChoice), d),
+					input.NewLedOp(randChoice(cChoice), d))
+			case 1:
+				fmt.Printf("Pushing fade over %s\n", d)
+				lC <- input.Play(input.LayerUI, input.Sequence(
+					input.Fade(randChoice(cChoice), randChoice(cChoice), d, input.Linear),
+					input.Fade(randChoice(cChoice), randChoice(cChoice), d, input.EaseInOut)))
+			case 2:
+				fmt.Printf("Pushing breathing with period %s\n", d)
+				lC <- input.Play(input.LayerUI, input.Breathe(randChoice(cChoice), d, 3*d))
+			case 3:
+				fmt.Printf("Pushing blinks with period %s\n", d)
+				lC <- input.Play(input.LayerUI, input.Blink(randChoice(cChoice), 3, d))
+			}
 		}
 	}
 }
 
-func UIDemo(bus uint, sigs <-chan os.Signal) {
-	r, err := input.NewRotary(input.Default(bus))
+func UIDemo(hw Hardware, cfg ui.Config, sigs <-chan os.Signal) {
+	r, err := hw.Rotary()
 	if err != nil {
 		fmt.Printf("failed to init rotatore: %s\n", err)
 		return
@@ -271,14 +284,13 @@ func UIDemo(bus uint, sigs <-chan os.Signal) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	intPin := i2cdev.NewIntPin(int_pin, rpio.FallEdge)
 	intC := make(chan time.Time)
-	go intDetector(ctx, intC, intPin)
+	go intDetector(ctx, intC, hw.IntPin())
 
 	l, lC := input.NewLED(r)
 	go l.Run(ctx)
 
-	u := ui.New(r, intC, lC, &ui.LoggerUpdate{})
+	u := ui.New(r, intC, lC, &ui.LoggerUpdate{}, cfg)
 	go u.Run(ctx)
 
 	for {
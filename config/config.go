@@ -0,0 +1,264 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aliher1911/blinds/actuator"
+	"github.com/aliher1911/blinds/auto"
+	"github.com/aliher1911/blinds/controller"
+	"github.com/aliher1911/blinds/fileutil"
+	"github.com/aliher1911/blinds/hass"
+	i2cdev "github.com/aliher1911/blinds/i2c"
+	"github.com/aliher1911/blinds/input"
+	"github.com/aliher1911/blinds/sensor"
+	"github.com/aliher1911/blinds/sim"
+	"github.com/aliher1911/blinds/ui"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config contains all tunables of the app. It is loaded from YAML file
+// where missing values are taken from defaults.
+type Config struct {
+	// I2C bus id shared by all devices.
+	Bus uint `yaml:"bus"`
+	// Physical angle that is treated as zero (-180, 180).
+	BaseAngle int32 `yaml:"base_angle"`
+	// GPIO pin connected to rotary interrupt line.
+	IntPin int `yaml:"int_pin"`
+	// Address to serve REST API on. Empty address disables API.
+	HTTPAddr string `yaml:"http_addr"`
+	// File to keep target, mode and learned values across restarts in.
+	// Empty path disables persistence.
+	StateFile string `yaml:"state_file"`
+
+	Stepper      actuator.Config   `yaml:"stepper"`
+	Magnetometer i2cdev.Conf       `yaml:"magnetometer"`
+	Rotary       input.Conf        `yaml:"rotary"`
+	LightSensor  i2cdev.Conf       `yaml:"light_sensor"`
+	Controller   controller.Config `yaml:"controller"`
+	UI           ui.Config         `yaml:"ui"`
+	MQTT         hass.Config       `yaml:"mqtt"`
+	Auto         auto.Config       `yaml:"auto"`
+	Sim          sim.Config        `yaml:"sim"`
+}
+
+const defaultBus = 1
+const defaultIntPin = 4
+
+func Defaults() Config {
+	return Config{
+		Bus:          defaultBus,
+		IntPin:       defaultIntPin,
+		Stepper:      actuator.Defaults(),
+		Magnetometer: sensor.Default(defaultBus),
+		Rotary:       input.Default(defaultBus),
+		LightSensor:  sensor.DefaultLight(defaultBus),
+		Controller:   controller.Defaults(),
+		UI:           ui.Defaults(),
+		MQTT:         hass.Defaults(),
+		Auto:         auto.Defaults(),
+		Sim:          sim.Defaults(),
+	}
+}
+
+// Load reads config file over defaults. Result must be validated after
+// applying any overrides.
+func Load(path string) (Config, error) {
+	cfg := Defaults()
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer f.Close()
+
+	d := yaml.NewDecoder(f)
+	d.KnownFields(true)
+	if err := d.Decode(&cfg); err != nil && err != io.EOF {
+		return Config{}, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	cfg.Propagate()
+	return cfg, nil
+}
+
+// Propagate copies shared values to device configs. Must be called after
+// changing shared values.
+func (c *Config) Propagate() {
+	c.Magnetometer.Bus = int(c.Bus)
+	c.Rotary.Bus = int(c.Bus)
+	c.LightSensor.Bus = int(c.Bus)
+}
+
+// Write saves config in YAML format.
+func (c Config) Write(w io.Writer) error {
+	e := yaml.NewEncoder(w)
+	e.SetIndent(2)
+	if err := e.Encode(c); err != nil {
+		return err
+	}
+	return e.Close()
+}
+
+// Validate checks that config values are usable and returns all found
+// problems.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.BaseAngle >= -180 && c.BaseAngle <= 180, "base_angle must be within [-180, 180], found %d", c.BaseAngle)
+	check(c.IntPin >= 0, "int_pin must be non negative, found %d", c.IntPin)
+
+	pins := make(map[int]bool)
+	usePin := func(name string, p int) {
+		check(p >= 0, "%s must be non negative, found %d", name, p)
+		check(!pins[p], "%s must be unique, found %d more than once", name, p)
+		pins[p] = true
+	}
+	switch sc := c.Stepper; sc.Driver {
+	case actuator.DriverGPIO:
+		check(len(sc.Pins) == 4, "stepper.pins must contain 4 pins, found %d", len(sc.Pins))
+		for _, p := range sc.Pins {
+			usePin("stepper.pins", p)
+		}
+		check(actuator.ValidMode(sc.Mode), "stepper.mode must be %s, %s or %s, found %q", actuator.ModeWave, actuator.ModeFull, actuator.ModeHalf, sc.Mode)
+	case actuator.DriverStepDir:
+		sd := sc.StepDir
+		usePin("stepper.step_dir.step_pin", sd.StepPin)
+		usePin("stepper.step_dir.dir_pin", sd.DirPin)
+		if sd.EnablePin >= 0 {
+			usePin("stepper.step_dir.enable_pin", sd.EnablePin)
+		}
+		for _, p := range sd.MicrostepPins {
+			usePin("stepper.step_dir.microstep_pins", p)
+		}
+		_, err := sd.MicrostepLevels()
+		check(err == nil, "stepper.step_dir: %s", err)
+		check(sd.PulseWidth > 0, "stepper.step_dir.pulse_width must be positive")
+	case actuator.DriverTMC2209:
+		tc := sc.TMC2209
+		usePin("stepper.tmc2209.step_pin", tc.StepPin)
+		usePin("stepper.tmc2209.dir_pin", tc.DirPin)
+		if tc.EnablePin >= 0 {
+			usePin("stepper.tmc2209.enable_pin", tc.EnablePin)
+		}
+		if tc.DiagPin >= 0 {
+			usePin("stepper.tmc2209.diag_pin", tc.DiagPin)
+		}
+		err := tc.Validate()
+		check(err == nil, "stepper.tmc2209: %s", err)
+	case actuator.DriverDC:
+		dc := sc.DC
+		usePin("stepper.dc.in1_pin", dc.In1Pin)
+		usePin("stepper.dc.in2_pin", dc.In2Pin)
+		usePin("stepper.dc.enable_pin", dc.EnablePin)
+		err := dc.Validate()
+		check(err == nil, "stepper.dc: %s", err)
+	default:
+		check(false, "stepper.driver must be %s, %s, %s or %s, found %q", actuator.DriverGPIO, actuator.DriverStepDir, actuator.DriverTMC2209, actuator.DriverDC, sc.Driver)
+	}
+	check(!pins[c.IntPin], "int_pin %d is used by stepper", c.IntPin)
+
+	check(c.Magnetometer.Addr > 0 && c.Magnetometer.Addr < 0x80, "magnetometer.addr must be a 7 bit address, found %#x", c.Magnetometer.Addr)
+	check(c.Rotary.Addr > 0 && c.Rotary.Addr < 0x80, "rotary.addr must be a 7 bit address, found %#x", c.Rotary.Addr)
+	check(c.Magnetometer.Addr != c.Rotary.Addr, "magnetometer.addr and rotary.addr must be different")
+	check(c.Rotary.NeopixelPin >= 0, "rotary.neopixel_pin must be non negative, found %d", c.Rotary.NeopixelPin)
+	check(c.Rotary.ButtonPin >= 0 && c.Rotary.ButtonPin < 32, "rotary.button_pin must be within [0, 32), found %d", c.Rotary.ButtonPin)
+
+	cc := c.Controller
+	check(cc.Delay > 0, "controller.delay must be positive")
+	check(cc.IdleDelay > 0, "controller.idle_delay must be positive")
+	check(cc.PosUpdateInterval > 0, "controller.pos_update_interval must be positive")
+	check(cc.StopMotionAfter > cc.PosUpdateInterval, "controller.stop_motion_after must be greater than pos_update_interval")
+	check(cc.StepsPerDegree > 0, "controller.steps_per_degree must be positive")
+	check(cc.LearnMinAngle > 0, "controller.learn_min_angle must be positive")
+	check(cc.LearnTolerance > 0, "controller.learn_tolerance must be positive")
+	check(cc.PositionAccuracy > 0, "controller.position_accuracy must be positive")
+	check(cc.MinSensorQuality >= 0 && cc.MinSensorQuality <= 1, "controller.min_sensor_quality must be within [0, 1]")
+	check(cc.MinAngle < cc.MaxAngle, "controller.min_angle must be less than max_angle")
+	check(cc.MinAngle >= -180 && cc.MaxAngle <= 180, "controller angles must be within [-180, 180]")
+	check(cc.MaxSpeed > 0, "controller.max_speed must be positive")
+	check(cc.Acceleration > 0, "controller.acceleration must be positive")
+	check(cc.StallWindow > 0, "controller.stall_window must be positive")
+	check(cc.StallMinProgress >= 0 && cc.StallMinProgress < 1, "controller.stall_min_progress must be within [0, 1)")
+	check(cc.HoldDuty > 0 && cc.HoldDuty <= 1, "controller.hold_duty must be within (0, 1]")
+	check(cc.HoldPeriod > 0, "controller.hold_period must be positive")
+	check(cc.MaxEnergized >= 0, "controller.max_energized must be non-negative")
+	check(cc.CoolDown >= 0, "controller.cool_down must be non-negative")
+	if c.Stepper.Driver == actuator.DriverDC {
+		pc := cc.PID
+		check(pc.Kp > 0, "controller.pid.kp must be positive")
+		check(pc.Ki >= 0, "controller.pid.ki must be non-negative")
+		check(pc.Kd >= 0, "controller.pid.kd must be non-negative")
+		check(pc.Deadband > 0, "controller.pid.deadband must be positive")
+		check(pc.MinSpeed >= 0 && pc.MinSpeed <= 1, "controller.pid.min_speed must be within [0, 1]")
+		check(pc.Interval > 0, "controller.pid.interval must be positive")
+		check(pc.StallTime > 0, "controller.pid.stall_time must be positive")
+	}
+
+	uc := c.UI
+	check(uc.ClickAngle != 0, "ui.click_angle must not be zero")
+	check(uc.MinAngle < uc.MaxAngle, "ui.min_angle must be less than max_angle")
+	check(uc.MinAngle >= cc.MinAngle && uc.MaxAngle <= cc.MaxAngle, "ui angles must be within controller angles")
+	check(uc.Debounce > 0, "ui.debounce must be positive")
+	check(uc.ApplyTimeout > 0, "ui.apply_timeout must be positive")
+	check(uc.LongPress > uc.Debounce, "ui.long_press must be greater than debounce")
+	check(uc.DoubleClick > 0, "ui.double_click must be positive")
+	check(uc.MenuTimeout > 0, "ui.menu_timeout must be positive")
+	check(uc.Preset >= uc.MinAngle && uc.Preset <= uc.MaxAngle, "ui.preset must be within ui angles, found %d", uc.Preset)
+
+	mc := c.MQTT
+	if mc.Broker != "" {
+		check(mc.NodeID != "", "mqtt.node_id must not be empty")
+		check(mc.TopicPrefix != "", "mqtt.topic_prefix must not be empty")
+		check(mc.UpdateInterval > 0, "mqtt.update_interval must be positive")
+	}
+
+	ac := c.Auto
+	check(ac.Interval > 0, "auto.interval must be positive")
+	for i, r := range ac.Schedule {
+		check(r.At != nil, "auto.schedule[%d].at must be set", i)
+		check(r.Angle >= cc.MinAngle && r.Angle <= cc.MaxAngle, "auto.schedule[%d].angle must be within controller angles, found %d", i, r.Angle)
+		check(r.Transition >= 0, "auto.schedule[%d].transition must be non negative", i)
+	}
+	if lc := ac.Light; lc.Enabled {
+		check(c.LightSensor.Addr > 0 && c.LightSensor.Addr < 0x80, "light_sensor.addr must be a 7 bit address, found %#x", c.LightSensor.Addr)
+		check(c.LightSensor.Addr != c.Magnetometer.Addr && c.LightSensor.Addr != c.Rotary.Addr, "light_sensor.addr must be different from magnetometer and rotary")
+		check(lc.Threshold > 0, "auto.light.threshold must be positive")
+		check(lc.Hysteresis >= 0 && lc.Hysteresis < lc.Threshold, "auto.light.hysteresis must be within [0, threshold)")
+		check(lc.MinDwell >= 0, "auto.light.min_dwell must be non negative")
+		check(lc.ClosedAngle >= cc.MinAngle && lc.ClosedAngle <= cc.MaxAngle, "auto.light.closed_angle must be within controller angles, found %d", lc.ClosedAngle)
+		check(lc.OpenAngle >= cc.MinAngle && lc.OpenAngle <= cc.MaxAngle, "auto.light.open_angle must be within controller angles, found %d", lc.OpenAngle)
+	}
+	if sun := ac.Sun; sun.Enabled {
+		check(sun.Latitude >= -90 && sun.Latitude <= 90, "auto.sun.latitude must be within [-90, 90], found %g", sun.Latitude)
+		check(sun.Longitude >= -180 && sun.Longitude <= 180, "auto.sun.longitude must be within [-180, 180], found %g", sun.Longitude)
+		check(sun.WindowAzimuth >= 0 && sun.WindowAzimuth < 360, "auto.sun.window_azimuth must be within [0, 360), found %g", sun.WindowAzimuth)
+		check(sun.SlatRatio > 0 && sun.SlatRatio <= 1, "auto.sun.slat_ratio must be within (0, 1], found %g", sun.SlatRatio)
+		check(sun.ShaftPerSlat != 0, "auto.sun.shaft_per_slat must not be zero")
+		check(sun.Angle >= cc.MinAngle && sun.Angle <= cc.MaxAngle, "auto.sun.angle must be within controller angles, found %d", sun.Angle)
+	}
+
+	sc := c.Sim
+	check(sc.StepsPerDegree > 0, "sim.steps_per_degree must be positive")
+	check(sc.Backlash >= 0, "sim.backlash must be non negative")
+	check(sc.Noise >= 0, "sim.noise must be non negative")
+	check(sc.MinStop < sc.MaxStop, "sim.min_stop must be less than max_stop")
+	check(sc.MissedSteps >= 0 && sc.MissedSteps < 1, "sim.missed_steps must be within [0, 1)")
+	check(sc.Lux >= 0, "sim.lux must be non negative")
+
+	return errors.Join(errs...)
+}
+
+// Save writes config to file replacing it atomically. Permissions of
+// existing file are kept, new file is only readable by owner as it could
+// contain MQTT password.
+func (c Config) Save(path string) error {
+	return fileutil.WriteAtomic(path, 0600, c.Write)
+}
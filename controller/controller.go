@@ -12,48 +12,86 @@ import (
 	i2cdev "github.com/aliher1911/blinds/i2c"
 	"github.com/aliher1911/blinds/sensor"
 
-	"github.com/stianeikeland/go-rpio/v4"
 	"golang.org/x/exp/constraints"
 )
 
 const NoAngle = -999999
 
 type Config struct {
-	// Delay between advances to current goal.
-	Delay time.Duration
+	// Delay before checking position after reaching step target.
+	Delay time.Duration `yaml:"delay"`
 	// Delay between advances to current goal if at target or detected a stall.
-	IdleDelay time.Duration
+	IdleDelay time.Duration `yaml:"idle_delay"`
 	// How frequently we read position sensor.
-	PosUpdateInterval time.Duration
+	PosUpdateInterval time.Duration `yaml:"pos_update_interval"`
 	// Stop movement if we can't get a valid reading for the period.
-	StopMotionAfter time.Duration
+	StopMotionAfter time.Duration `yaml:"stop_motion_after"`
 	// Stepper + gearbox reduction param.
-	StepsPerDegree int64
+	StepsPerDegree float64 `yaml:"steps_per_degree"`
+	// Refine steps per degree from sensor feedback while moving.
+	LearnStepsPerDegree bool `yaml:"learn_steps_per_degree"`
+	// Min shaft rotation between readings to use them for learning.
+	LearnMinAngle int32 `yaml:"learn_min_angle"`
+	// Max relative deviation of learning sample from current estimate.
+	LearnTolerance float64 `yaml:"learn_tolerance"`
 	// Threshold within target that we consider to be spot on.
-	PositionAccuracy int32
-
-	MinAngle int32
-	MaxAngle int32
-
-	MinRate float32
-	MaxRate float32
-
-	IntPin int
+	PositionAccuracy int32 `yaml:"position_accuracy"`
+	// Sensor readings with lower quality are treated as failed reads.
+	MinSensorQuality float32 `yaml:"min_sensor_quality"`
+
+	MinAngle int32 `yaml:"min_angle"`
+	MaxAngle int32 `yaml:"max_angle"`
+	// Max stepping speed in steps/s.
+	MaxSpeed float64 `yaml:"max_speed"`
+	// Acceleration and deceleration of stepping in steps/s².
+	Acceleration float64 `yaml:"acceleration"`
+	// Number of steps over which shaft progress is checked to detect stalls.
+	StallWindow int64 `yaml:"stall_window"`
+	// Min fraction of expected rotation shaft must make over stall window.
+	StallMinProgress float64 `yaml:"stall_min_progress"`
+	// How long coils stay energized after move to prevent slats from
+	// back-driving the gearbox. Zero releases coils immediately, negative
+	// holds until next move.
+	HoldTime time.Duration `yaml:"hold_time"`
+	// Fraction of time coils are powered while holding to reduce current.
+	// Ignored by drivers that regulate current on their own.
+	HoldDuty float64 `yaml:"hold_duty"`
+	// Period of switching coils on and off while holding.
+	HoldPeriod time.Duration `yaml:"hold_period"`
+	// Max continuous energized time weighted by hold duty. Coils are
+	// released when exceeded and not held until cooled down. Zero disables
+	// the limit.
+	MaxEnergized time.Duration `yaml:"max_energized"`
+	// Time coils must stay released to cool down.
+	CoolDown time.Duration `yaml:"cool_down"`
+	// Speed control of motors without steps.
+	PID PIDConfig `yaml:"pid"`
 }
 
 func Defaults() Config {
 	return Config{
-		Delay:             75 * time.Microsecond,
-		IdleDelay:         time.Second,
-		PosUpdateInterval: time.Second,
-		StopMotionAfter:   5 * time.Second,
-		StepsPerDegree:    180,
-		PositionAccuracy:  5,
-		MinAngle:          -140,
-		MaxAngle:          140,
-		MinRate:           0.0001,
-		MaxRate:           0.01,
-		IntPin:            -1,
+		Delay:               75 * time.Microsecond,
+		IdleDelay:           time.Second,
+		PosUpdateInterval:   time.Second,
+		StopMotionAfter:     5 * time.Second,
+		StepsPerDegree:      180,
+		LearnStepsPerDegree: true,
+		LearnMinAngle:       10,
+		LearnTolerance:      0.25,
+		PositionAccuracy:    5,
+		MinSensorQuality:    0.2,
+		MinAngle:            -140,
+		MaxAngle:            140,
+		MaxSpeed:            10000,
+		Acceleration:        20000,
+		StallWindow:         1800,
+		StallMinProgress:    0.3,
+		HoldTime:            0,
+		HoldDuty:            0.5,
+		HoldPeriod:          10 * time.Millisecond,
+		MaxEnergized:        10 * time.Minute,
+		CoolDown:            5 * time.Minute,
+		PID:                 PIDDefaults(),
 	}
 }
 
@@ -62,65 +100,138 @@ func Defaults() Config {
 // to handle UI interrupts.
 type Controller struct {
 	Config
-	s *actuator.Stepper
-	p *sensor.Position
+	s actuator.Motor
+	p sensor.AngleSensor
+	// Half steps made by single motor step.
+	stepSize float64
 
-	intPin i2cdev.IntPin
+	intPin i2cdev.Interrupt
 	intC   chan time.Time
 
-	lastAngle   int32
-	targetAngle int32
-	targetC     chan int32
+	targetC chan int32
+	stopC   chan interface{}
+
+	// Protects status, subscribers and limits.
+	mu     sync.Mutex
+	status Status
+	subs   map[chan Event]struct{}
+	// Range of accepted targets within configured angles.
+	minAngle int32
+	maxAngle int32
 
 	startedC chan interface{}
 	stoppedC chan interface{}
 }
 
-func NewController(s *actuator.Stepper, p *sensor.Position, cfg Config) *Controller {
+// NewController creates controller for motor. Step values in config are
+// motor half steps and are scaled to steps of the motor driver.
+func NewController(s actuator.Motor, p sensor.AngleSensor, cfg Config) *Controller {
+	size := s.Capabilities().StepScale()
+	halfSteps := cfg.StepsPerDegree
+	cfg.StepsPerDegree /= size
+	cfg.MaxSpeed /= size
+	cfg.Acceleration /= size
+	cfg.StallWindow = int64(math.Round(float64(cfg.StallWindow) / size))
 	c := &Controller{
-		Config:      cfg,
-		s:           s,
-		p:           p,
-		lastAngle:   NoAngle,
-		targetAngle: NoAngle,
-		targetC:     make(chan int32, 1),
-	}
-	if cfg.IntPin >= 0 {
-		// We do this because this is the only tight loop in the app.
-		c.intC = make(chan time.Time)
-		c.intPin = i2cdev.NewIntPin(cfg.IntPin, rpio.FallEdge)
+		Config:   cfg,
+		s:        s,
+		p:        p,
+		stepSize: size,
+		targetC:  make(chan int32, 1),
+		stopC:    make(chan interface{}, 1),
+		status: Status{
+			Target:         NoAngle,
+			Angle:          NoAngle,
+			StepsPerDegree: halfSteps,
+		},
+		subs:     make(map[chan Event]struct{}),
+		minAngle: cfg.MinAngle,
+		maxAngle: cfg.MaxAngle,
 	}
 	return c
 }
 
+// PollInterrupts makes controller check pin for edges and forward them
+// to InterruptC. We do this because this is the only tight loop in the app.
+// Must be called before Run.
+func (c *Controller) PollInterrupts(pin i2cdev.Interrupt) {
+	c.intC = make(chan time.Time)
+	c.intPin = pin
+}
+
 // Pos reads current position
 func (c *Controller) Pos() int32 {
-	return atomic.LoadInt32(&c.lastAngle)
+	return c.Status().Angle
+}
+
+// SetLimits narrows range of targets within configured min and max angle.
+// Current target is kept, only targets set afterwards are clamped.
+func (c *Controller) SetLimits(min, max int32) {
+	if min < c.MinAngle {
+		min = c.MinAngle
+	}
+	if max > c.MaxAngle {
+		max = c.MaxAngle
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.minAngle, c.maxAngle = min, max
+}
+
+// Limits returns range of accepted targets.
+func (c *Controller) Limits() (int32, int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.minAngle, c.maxAngle
 }
 
-// SetTarget sets desired shaft angle
+// SetTarget sets desired shaft angle. Setting target clears fault.
 func (c *Controller) SetTarget(angle int32) {
-	if angle < c.MinAngle {
-		angle = c.MinAngle
+	c.mu.Lock()
+	if angle < c.minAngle {
+		angle = c.minAngle
 	}
-	if angle > c.MaxAngle {
-		angle = c.MaxAngle
+	if angle > c.maxAngle {
+		angle = c.maxAngle
 	}
-	if angle == c.targetAngle {
+	if angle == c.status.Target && c.status.Fault == nil {
+		c.mu.Unlock()
 		return
 	}
-	c.targetAngle = angle
+	c.status.Target = angle
+	c.mu.Unlock()
 	c.targetC <- angle
 }
 
+// Stop interrupts movement. Shaft decelerates and stays where it stopped
+// which becomes new target.
+func (c *Controller) Stop() {
+	select {
+	case c.stopC <- nil:
+	default:
+	}
+}
+
+// Fault returns error if controller stopped motor because of malfunction.
+// Motor stays powered off until new target is set.
+func (c *Controller) Fault() error {
+	return c.Status().Fault
+}
+
 // AtTarget is true if shaft is positioned at target
 func (c *Controller) AtTarget() bool {
-	return abs(c.targetAngle-c.Pos())*2 < c.PositionAccuracy
+	return c.Status().AtTarget
 }
 
 // Target restuns set shaft angle.
 func (c *Controller) Target() int32 {
-	return c.targetAngle
+	return c.Status().Target
+}
+
+// LearnedStepsPerDegree returns current steps per degree estimate. It is the
+// configured value unless learning is enabled.
+func (c *Controller) LearnedStepsPerDegree() float64 {
+	return c.Status().StepsPerDegree
 }
 
 func (c *Controller) InterruptC() <-chan time.Time {
@@ -133,7 +244,13 @@ type posUpdate struct {
 	angle     int32 // TODO: maybe change to float
 }
 
+// Run moves shaft to target until context is cancelled. Stepper position is
+// tracked by counting steps and corrected by sensor readings, motors without
+// steps are driven by speed from sensor readings alone.
 func (c *Controller) Run(ctx context.Context) error {
+	if m, ok := c.s.(actuator.SpeedMotor); ok {
+		return c.runSpeed(ctx, m)
+	}
 	var wg sync.WaitGroup
 	defer wg.Wait()
 
@@ -155,6 +272,19 @@ func (c *Controller) Run(ctx context.Context) error {
 		pos:   0,
 		angle: NoAngle,
 	}
+	hold := newCoilHold(c.s, c.Config)
+	// Driver stall and fault detection supplements stall detection from
+	// sensor readings.
+	driverStall, _ := c.s.(actuator.StallSensor)
+	// Slow driver status reads are done in background and reported here.
+	driverFaultC := make(chan error, 1)
+	if mon, ok := c.s.(actuator.StatusMonitor); ok {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.monitorDriver(ctx, mon, driverFaultC)
+		}()
+	}
 	// Must always be run inside wait group.
 	var updatePending = false
 	defer func() {
@@ -162,49 +292,142 @@ func (c *Controller) Run(ctx context.Context) error {
 			// Wait for pos reader to terminate so that its chan is unblocked.
 			<-readPosC
 		}
-		c.s.PowerOff()
+		hold.release(time.Now())
 	}()
 
 	updateFn := func() {
-		now := time.Now()
 		savedPos := atomic.LoadInt64(&pos)
-		a, err := c.p.Read()
-		if err != nil {
+		r, err := c.p.Read()
+		switch {
+		case err != nil:
 			readPosC <- posUpdate{
 				angle: NoAngle,
 			}
-		} else {
+		case r.Quality < c.MinSensorQuality:
+			fmt.Printf("ctrl: Discarding sensor reading with quality %.2f\n", r.Quality)
 			readPosC <- posUpdate{
-				timeStamp: now,
+				angle: NoAngle,
+			}
+		default:
+			readPosC <- posUpdate{
+				timeStamp: r.Time,
 				pos:       savedPos,
-				angle:     int32(a),
+				angle:     int32(r.Angle),
 			}
 		}
 		wg.Done()
 	}
 
 	var reachedTarget bool
+	// Shaft settled at target and it was announced to subscribers.
+	var arrived bool
 	var safetyStop bool
+	var moving bool
+	// Stop was requested and we wait for shaft to settle to pick new target.
+	var stopping bool
+
+	profile := newMotionProfile(c.MaxSpeed, c.Acceleration)
+	learn := newStepsEstimator(c.StepsPerDegree, c.LearnMinAngle, c.LearnTolerance)
+	stall := newStallDetector(c.StallWindow, c.StallMinProgress)
+	var faulted bool
+
+	driverFault := func(err error) {
+		fmt.Printf("ctrl: %s\n", err)
+		faulted = true
+		profile.stop()
+		moving = false
+		hold.release(time.Now())
+		c.update(func(s *Status) {
+			s.Moving = false
+			s.Fault = err
+		}, FaultEntered)
+	}
 
 	for {
 		// Check if we received any commands/updates or temination request.
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
+		case err := <-driverFaultC:
+			if !faulted {
+				driverFault(err)
+			}
+			// Faulted controller doesn't step, so there is no step timing
+			// to keep and we can check other channels right away.
+			continue
 		case targetAngle = <-c.targetC:
 			// Handle target update.
 			reachedTarget = false
-			targetPos = c.targetSteps(shaftPos, targetAngle, c.StepsPerDegree)
+			arrived = false
+			stopping = false
+			if faulted {
+				faulted = false
+				fmt.Println("ctrl: Fault cleared by new target")
+				c.update(func(s *Status) {
+					s.Target = targetAngle
+					s.Fault = nil
+				}, FaultCleared)
+			} else {
+				c.update(func(s *Status) {
+					s.Target = targetAngle
+				})
+			}
+			if shaftPos.angle != NoAngle {
+				// Otherwise wait for the first reading to compute steps.
+				targetPos = c.targetSteps(shaftPos, targetAngle, learn.value)
+			}
+		case <-c.stopC:
+			// Decelerate and forget target until shaft settles.
+			targetAngle = NoAngle
+			reachedTarget = false
+			arrived = false
+			stopping = true
+			targetPos = pos + int64(sign(profile.speed))*profile.stopDistance()
+			// Any target including previous one is accepted again.
+			c.update(func(s *Status) {
+				s.Target = NoAngle
+			})
 		case newShaftPos := <-readPosC:
 			// Handle shaft angle update.
 			updatePending = false
 			if newShaftPos.angle != NoAngle {
 				// No error reading shaft.
+				var events []EventType
+				if newShaftPos.angle != shaftPos.angle {
+					events = append(events, PositionUpdate)
+				}
+				if safetyStop {
+					fmt.Println("ctrl: Sensor readings resumed")
+					events = append(events, SafetyStopCleared)
+				}
+				if c.LearnStepsPerDegree {
+					learn.update(newShaftPos)
+				}
+				var fault error
+				if err := stall.update(newShaftPos, learn.value); err != nil && !faulted {
+					fmt.Printf("ctrl: %s\n", err)
+					faulted = true
+					fault = err
+					events = append(events, FaultEntered)
+					stall = newStallDetector(c.StallWindow, c.StallMinProgress)
+					profile.stop()
+					moving = false
+					hold.release(time.Now())
+				}
+				if stopping && reachedTarget {
+					// Stopped after interrupting movement, keep shaft where it is.
+					stopping = false
+					targetAngle = newShaftPos.angle
+				}
 				da := abs(newShaftPos.angle - targetAngle)
 				// Adjust if we didn't zero on target, then only if we are too far away.
 				if targetAngle != NoAngle && (!reachedTarget && da > 0 || reachedTarget && da*2 > c.PositionAccuracy) {
-					targetPos = c.targetSteps(newShaftPos, targetAngle, c.StepsPerDegree)
+					targetPos = c.targetSteps(newShaftPos, targetAngle, learn.value)
 					reachedTarget = false
+					arrived = false
+				} else if reachedTarget && !arrived && targetAngle != NoAngle {
+					arrived = true
+					events = append(events, TargetReached)
 				}
 				//fmt.Printf("ctrl: update: pos=%d, targetPos=%d, readPos=%d(dp=%d), "+
 				//	"angle=%d, targetAngle=%d\n",
@@ -213,7 +436,18 @@ func (c *Controller) Run(ctx context.Context) error {
 				// Save current values.
 				shaftPos = newShaftPos
 				safetyStop = false
-				atomic.StoreInt32(&c.lastAngle, shaftPos.angle)
+				c.update(func(s *Status) {
+					s.Angle = shaftPos.angle
+					if targetAngle != NoAngle {
+						s.Target = targetAngle
+					}
+					s.SafetyStop = false
+					s.Moving = moving
+					s.StepsPerDegree = learn.value * c.stepSize
+					if fault != nil {
+						s.Fault = fault
+					}
+				}, events...)
 			}
 		default:
 		}
@@ -227,27 +461,50 @@ func (c *Controller) Run(ctx context.Context) error {
 				wg.Add(1)
 				go updateFn()
 			}
-			if sinceUpdate > c.StopMotionAfter {
+			if sinceUpdate > c.StopMotionAfter && !safetyStop {
 				// Prevent any movements to avoid crashing into stops.
 				fmt.Printf("ctrl: No updates for %s, stopping motion\n", sinceUpdate)
 				safetyStop = true
+				moving = false
+				c.update(func(s *Status) {
+					s.SafetyStop = true
+					s.Moving = false
+				}, SafetyStopEntered)
 			}
 		}
 
 		// Update stepper and calculate next step delay.
 		var next <-chan time.Time
-		pd := targetPos - pos
+		var dir int
+		var stepDelay time.Duration
+		if !safetyStop && !faulted {
+			dir, stepDelay = profile.next(targetPos - pos)
+		}
 		switch {
+		case faulted:
+			next = time.After(c.IdleDelay)
 		case safetyStop:
+			profile.stop()
+			hold.stopped(time.Now())
 			next = time.After(c.IdleDelay)
-		case pd > 0:
-			c.s.Step(1)
-			atomic.AddInt64(&pos, 1)
-			next = time.After(c.Delay)
-		case pd < 0:
-			c.s.Step(-1)
-			atomic.AddInt64(&pos, -1)
-			next = time.After(c.Delay)
+		case dir != 0:
+			if !moving {
+				moving = true
+				c.update(func(s *Status) {
+					s.Moving = true
+				}, MoveStarted)
+			}
+			hold.step(time.Now())
+			c.s.Step(dir)
+			learn.step(dir)
+			stall.step(dir)
+			atomic.AddInt64(&pos, int64(dir))
+			next = time.After(stepDelay)
+			if driverStall != nil {
+				if err := driverStall.Stalled(); err != nil {
+					driverFault(err)
+				}
+			}
 		default:
 			// When steps are reached trigger immediate update and ignore extra delay if first
 			// attempt.
@@ -262,24 +519,28 @@ func (c *Controller) Run(ctx context.Context) error {
 				next = time.After(c.IdleDelay)
 			}
 			reachedTarget = true
-			c.s.PowerOff()
+			if moving {
+				moving = false
+				c.update(func(s *Status) {
+					s.Moving = false
+				})
+			}
+			hold.stopped(time.Now())
 		}
 
 		// Wait for next loop time.
 	stepper_delay:
 		for {
-			// Handle interrupt polling as it is the only busy loop in app.
-			// Maybe we should make it a callback to decouple?
-			if c.intPin.EdgeDetected() {
-				select {
-				case c.intC <- time.Now():
-				default:
-				}
+			c.pollInterrupt()
+			// Coils are switched on time while holding.
+			wait := 20 * time.Millisecond
+			if d := hold.tick(time.Now()); d < wait {
+				wait = d
 			}
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
-			case <-time.After(20 * time.Millisecond):
+			case <-time.After(wait):
 			case <-next:
 				break stepper_delay
 			}
@@ -287,14 +548,43 @@ func (c *Controller) Run(ctx context.Context) error {
 	}
 }
 
-// Compute new target step counter.
-func (cfg *Config) targetSteps(p posUpdate, targetAngle int32, speed int64) int64 {
-	da := -int64(targetAngle - p.angle)
-	if da < 10 {
-		// Reduce speed if reaching destination.
-		speed = speed / 2
+// monitorDriver checks driver status until context is cancelled. Errors are
+// dropped if controller didn't pick up previous one yet.
+func (c *Controller) monitorDriver(ctx context.Context, mon actuator.StatusMonitor, errC chan<- error) {
+	t := time.NewTicker(mon.PollInterval())
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := mon.CheckStatus(); err != nil {
+			select {
+			case errC <- err:
+			default:
+			}
+		}
 	}
-	pSteps := p.pos + da*speed
+}
+
+// pollInterrupt forwards edges of interrupt pin. Controller handles interrupt
+// polling as it is the only busy loop in app.
+// Maybe we should make it a callback to decouple?
+func (c *Controller) pollInterrupt() {
+	if c.intPin != nil && c.intPin.EdgeDetected() {
+		select {
+		case c.intC <- time.Now():
+		default:
+		}
+	}
+}
+
+// Compute new target step counter.
+func (cfg *Config) targetSteps(p posUpdate, targetAngle int32, stepsPerDegree float64) int64 {
+	// Stepping forward decreases angle.
+	da := -float64(targetAngle - p.angle)
+	pSteps := p.pos + int64(math.Round(da*stepsPerDegree))
 	return pSteps
 }
 
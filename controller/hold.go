@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aliher1911/blinds/actuator"
+)
+
+// Wait time when no coil switch is scheduled.
+const noSwitch = time.Duration(1<<63 - 1)
+
+// coilHold manages motor power between moves. Coils stay energized for
+// hold time after motor stops so that slats don't back-drive the gearbox.
+// Hold current is reduced by switching coils on and off within PWM period
+// unless driver regulates current on its own. Continuous energization is
+// limited to protect motor from overheating.
+type coilHold struct {
+	m actuator.Motor
+	// How long coils stay energized after move, negative to keep them
+	// energized until next move.
+	holdTime time.Duration
+	// Fraction of PWM period coils are on while holding.
+	duty float64
+	// PWM period while holding.
+	period time.Duration
+	// Max continuous energized time weighted by duty, zero if unlimited.
+	maxEnergized time.Duration
+	// Time coils must be released to reset energized time.
+	coolDown time.Duration
+
+	// Motor is moving and coils are energized by steps.
+	moving bool
+	// Coils are held after move.
+	holding bool
+	// End of hold period.
+	until time.Time
+	// Coils are on within PWM period.
+	on bool
+	// Start of current PWM period.
+	cycle time.Time
+	// Energized time accumulated since coils were last cooled down.
+	energized time.Duration
+	// Coils were released because of energized time limit and can't be
+	// held until cooled down.
+	overheated bool
+	// Last time energized time was updated.
+	last time.Time
+	// Time coils were released.
+	released time.Time
+}
+
+func newCoilHold(m actuator.Motor, cfg Config) coilHold {
+	caps := m.Capabilities()
+	holdTime := cfg.HoldTime
+	if !caps.Holding {
+		holdTime = 0
+	}
+	duty := cfg.HoldDuty
+	if caps.CurrentControl {
+		// Switching driver enable input would lose current regulation.
+		duty = 1
+	}
+	return coilHold{
+		m:            m,
+		holdTime:     holdTime,
+		duty:         duty,
+		period:       cfg.HoldPeriod,
+		maxEnergized: cfg.MaxEnergized,
+		coolDown:     cfg.CoolDown,
+	}
+}
+
+// level returns fraction of time coils are currently powered.
+func (h *coilHold) level() float64 {
+	switch {
+	case h.moving:
+		return 1
+	case h.holding:
+		return h.duty
+	}
+	return 0
+}
+
+// account adds energized time since last update. Released coils reset it
+// once they were off for cool down period.
+func (h *coilHold) account(now time.Time) {
+	if !h.last.IsZero() {
+		h.energized += time.Duration(float64(now.Sub(h.last)) * h.level())
+	}
+	h.last = now
+	if h.level() == 0 && h.energized > 0 && now.Sub(h.released) >= h.coolDown {
+		if h.overheated {
+			fmt.Println("ctrl: Coils cooled down")
+		}
+		h.energized = 0
+		h.overheated = false
+	}
+}
+
+// step is called before motor makes a step which energizes coils.
+func (h *coilHold) step(now time.Time) {
+	if h.moving {
+		return
+	}
+	h.account(now)
+	h.moving = true
+	h.holding = false
+}
+
+// stopped is called while motor is not stepping. It starts hold period
+// after a move.
+func (h *coilHold) stopped(now time.Time) {
+	if !h.moving {
+		return
+	}
+	h.account(now)
+	h.moving = false
+	if h.holdTime == 0 || h.overheated {
+		h.release(now)
+		return
+	}
+	h.holding = true
+	h.until = now.Add(h.holdTime)
+	h.on = true
+	h.cycle = now
+}
+
+// release powers off coils immediately.
+func (h *coilHold) release(now time.Time) {
+	h.account(now)
+	h.moving = false
+	h.holding = false
+	h.released = now
+	h.m.PowerOff()
+}
+
+// tick switches coils according to hold policy and returns time until
+// next switch, noSwitch if nothing is scheduled.
+func (h *coilHold) tick(now time.Time) time.Duration {
+	h.account(now)
+	if !h.holding {
+		return noSwitch
+	}
+	if h.maxEnergized > 0 && h.energized >= h.maxEnergized {
+		fmt.Printf("ctrl: Coils energized for %s, releasing until cooled down\n", h.energized)
+		h.overheated = true
+		h.release(now)
+		return noSwitch
+	}
+	if h.holdTime >= 0 && !now.Before(h.until) {
+		h.release(now)
+		return noSwitch
+	}
+	if h.duty >= 1 {
+		return h.untilRelease(now, noSwitch)
+	}
+	// Advance PWM cycle and switch coils when crossing on/off boundary.
+	elapsed := now.Sub(h.cycle)
+	if elapsed >= h.period {
+		h.cycle = h.cycle.Add(elapsed / h.period * h.period)
+		elapsed = now.Sub(h.cycle)
+	}
+	onTime := time.Duration(float64(h.period) * h.duty)
+	on := elapsed < onTime
+	if on != h.on {
+		h.on = on
+		if on {
+			h.m.PowerOn()
+		} else {
+			h.m.PowerOff()
+		}
+	}
+	if on {
+		return h.untilRelease(now, onTime-elapsed)
+	}
+	return h.untilRelease(now, h.period-elapsed)
+}
+
+// untilRelease limits wait time by the end of hold period.
+func (h *coilHold) untilRelease(now time.Time, d time.Duration) time.Duration {
+	if h.holdTime < 0 {
+		return d
+	}
+	if r := h.until.Sub(now); r < d {
+		return r
+	}
+	return d
+}
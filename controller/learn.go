@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"math"
+	"sort"
+)
+
+// Number of recent samples used to compute estimate.
+const learnWindow = 15
+
+// Number of samples needed before median is used to reject outliers.
+// Until then samples are only checked to be within learnPriorRange of
+// configured value.
+const learnMinSamples = 5
+const learnPriorRange = 3
+
+// stepsEstimator learns stepper steps per degree of shaft rotation from
+// pairs of step counter and shaft angle changes between sensor readings.
+type stepsEstimator struct {
+	// Min shaft rotation to use pair as a sample.
+	minAngle int32
+	// Max relative deviation of sample from median to be accepted.
+	tolerance float64
+	// Configured value used until we collect samples.
+	prior float64
+
+	// Reading samples are measured from.
+	base posUpdate
+	// Direction of last step.
+	dir int
+
+	samples []float64
+	next    int
+	value   float64
+}
+
+func newStepsEstimator(prior float64, minAngle int32, tolerance float64) stepsEstimator {
+	return stepsEstimator{
+		minAngle:  minAngle,
+		tolerance: tolerance,
+		prior:     prior,
+		base:      posUpdate{angle: NoAngle},
+		value:     prior,
+	}
+}
+
+// step records stepper direction. Reversing direction invalidates current
+// sample as gearbox backlash distorts angle change.
+func (e *stepsEstimator) step(dir int) {
+	if dir != e.dir {
+		e.dir = dir
+		e.base.angle = NoAngle
+	}
+}
+
+// update adds new shaft reading and returns true if estimate changed.
+func (e *stepsEstimator) update(u posUpdate) bool {
+	if e.base.angle == NoAngle {
+		e.base = u
+		return false
+	}
+	da := u.angle - e.base.angle
+	if abs(da) < e.minAngle {
+		// Wait for more movement to reduce error of angle quantization.
+		return false
+	}
+	ds := u.pos - e.base.pos
+	e.base = u
+	// Stepping forward decreases angle.
+	sample := -float64(ds) / float64(da)
+	if !e.accept(sample) {
+		return false
+	}
+	if len(e.samples) < learnWindow {
+		e.samples = append(e.samples, sample)
+	} else {
+		e.samples[e.next] = sample
+		e.next = (e.next + 1) % learnWindow
+	}
+	e.value = median(e.samples)
+	return true
+}
+
+func (e *stepsEstimator) accept(sample float64) bool {
+	if sample <= 0 {
+		// Shaft moved against stepper direction, probably slipping.
+		return false
+	}
+	if len(e.samples) < learnMinSamples {
+		return sample > e.prior/learnPriorRange && sample < e.prior*learnPriorRange
+	}
+	return math.Abs(sample-e.value) <= e.value*e.tolerance
+}
+
+func median(vals []float64) float64 {
+	s := append([]float64(nil), vals...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
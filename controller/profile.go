@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"math"
+	"time"
+)
+
+// motionProfile plans trapezoidal speed ramp for stepper. It accelerates
+// from standstill up to max speed, cruises and then decelerates so that it
+// stops at the target. Profile is re-planned on every step so target could
+// be changed at any time, including reversing direction mid-move.
+type motionProfile struct {
+	// Max speed in steps/s.
+	maxSpeed float64
+	// Acceleration and deceleration in steps/s².
+	accel float64
+	// Current speed in steps/s. Sign is the direction of motion.
+	speed float64
+}
+
+func newMotionProfile(maxSpeed, accel float64) motionProfile {
+	return motionProfile{
+		maxSpeed: maxSpeed,
+		accel:    accel,
+	}
+}
+
+// minSpeed is the speed motor reaches after a single step from standstill.
+// We never go slower than that while moving as it would only waste time.
+func (m *motionProfile) minSpeed() float64 {
+	return math.Min(math.Sqrt(2*m.accel), m.maxSpeed)
+}
+
+// stopDistance is the number of steps needed to stop from current speed.
+func (m *motionProfile) stopDistance() int64 {
+	return int64(math.Ceil(m.speed * m.speed / (2 * m.accel)))
+}
+
+// next computes direction of the next step and delay after it given the
+// number of steps remaining to target. Returns zero direction when motor
+// is at target and stopped.
+func (m *motionProfile) next(remaining int64) (int, time.Duration) {
+	dir := sign(m.speed)
+	if dir == 0 {
+		dir = sign(remaining)
+	}
+	if dir == 0 {
+		return 0, 0
+	}
+
+	// Steps left in the direction we are moving. Negative if we overshot
+	// or target moved behind us.
+	ahead := remaining * int64(dir)
+	v2 := m.speed * m.speed
+	switch {
+	case ahead <= 0 || ahead <= m.stopDistance():
+		v2 -= 2 * m.accel
+	case v2 < m.maxSpeed*m.maxSpeed:
+		v2 = math.Min(v2+2*m.accel, m.maxSpeed*m.maxSpeed)
+	}
+
+	minSpeed := m.minSpeed()
+	if v2 < minSpeed*minSpeed {
+		// Slowed down enough to stop or change direction.
+		if remaining == 0 {
+			m.speed = 0
+			return 0, 0
+		}
+		dir = sign(remaining)
+		v2 = minSpeed * minSpeed
+	}
+
+	v := math.Sqrt(v2)
+	m.speed = float64(dir) * v
+	return dir, time.Duration(float64(time.Second) / v)
+}
+
+// stop resets profile to standstill. Used when motion is interrupted
+// externally.
+func (m *motionProfile) stop() {
+	m.speed = 0
+}
+
+func sign[T int64 | float64](val T) int {
+	switch {
+	case val > 0:
+		return 1
+	case val < 0:
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,225 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/aliher1911/blinds/actuator"
+)
+
+// Min shaft rotation in degrees that counts as progress for stall detection
+// of motors without steps.
+const progressAngle = 2
+
+type PIDConfig struct {
+	// Gains applied to angle error in degrees to compute speed in [-1, 1].
+	Kp float64 `yaml:"kp"`
+	Ki float64 `yaml:"ki"`
+	Kd float64 `yaml:"kd"`
+	// Motor stops when shaft is within deadband degrees from target and
+	// starts again when it is twice as far.
+	Deadband float64 `yaml:"deadband"`
+	// Min speed that overcomes friction and gearbox load.
+	MinSpeed float64 `yaml:"min_speed"`
+	// How frequently angle is read and speed is updated.
+	Interval time.Duration `yaml:"interval"`
+	// Stop motor if shaft doesn't rotate while driven for the period.
+	StallTime time.Duration `yaml:"stall_time"`
+}
+
+func PIDDefaults() PIDConfig {
+	return PIDConfig{
+		Kp:        0.04,
+		Ki:        0.01,
+		Kd:        0.002,
+		Deadband:  1.5,
+		MinSpeed:  0.3,
+		Interval:  20 * time.Millisecond,
+		StallTime: 2 * time.Second,
+	}
+}
+
+// pid computes motor speed from angle error.
+type pid struct {
+	cfg PIDConfig
+
+	integral float64
+	lastErr  float64
+	started  bool
+}
+
+func (p *pid) reset() {
+	p.integral = 0
+	p.started = false
+}
+
+// update returns speed for error in degrees measured dt seconds after
+// previous one.
+func (p *pid) update(e, dt float64) float64 {
+	if !p.started {
+		dt = 0
+	}
+	var d float64
+	if dt > 0 {
+		d = (e - p.lastErr) / dt
+	}
+	p.lastErr = e
+	p.started = true
+	out := p.cfg.Kp*e + p.cfg.Ki*(p.integral+e*dt) + p.cfg.Kd*d
+	// Integrate only while output isn't saturated to avoid windup.
+	if math.Abs(out) < 1 {
+		p.integral += e * dt
+	}
+	if math.Abs(out) < p.cfg.MinSpeed {
+		out = math.Copysign(p.cfg.MinSpeed, out)
+	}
+	return math.Max(-1, math.Min(1, out))
+}
+
+// runSpeed drives motor that can't step. Speed is computed by PID from
+// difference between sensor angle and target.
+func (c *Controller) runSpeed(ctx context.Context, m actuator.SpeedMotor) error {
+	defer c.s.PowerOff()
+
+	ctl := pid{cfg: c.PID}
+	var targetAngle int32 = NoAngle
+	// Last good reading.
+	var angle float64
+	// Safety stop is counted from start until first reading.
+	lastRead := time.Now()
+	var reported int32 = NoAngle
+	var moving bool
+	var arrived bool
+	var safetyStop bool
+	var faulted bool
+	// Last time shaft made progress while driven.
+	var progress time.Time
+	var progressFrom float64
+
+	stop := func() {
+		c.s.PowerOff()
+		ctl.reset()
+		if moving {
+			moving = false
+			c.update(func(s *Status) {
+				s.Moving = false
+			})
+		}
+	}
+
+	t := time.NewTicker(c.PID.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case targetAngle = <-c.targetC:
+			arrived = false
+			ctl.reset()
+			if faulted {
+				faulted = false
+				fmt.Println("ctrl: Fault cleared by new target")
+				c.update(func(s *Status) {
+					s.Target = targetAngle
+					s.Fault = nil
+				}, FaultCleared)
+			} else {
+				c.update(func(s *Status) {
+					s.Target = targetAngle
+				})
+			}
+			continue
+		case <-c.stopC:
+			// Motor stops almost immediately, keep shaft where it is.
+			if reported != NoAngle {
+				targetAngle = int32(math.Round(angle))
+				c.update(func(s *Status) {
+					s.Target = targetAngle
+				})
+			}
+			stop()
+			continue
+		case <-t.C:
+		}
+		c.pollInterrupt()
+
+		r, err := c.p.Read()
+		if err == nil && r.Quality < c.MinSensorQuality {
+			fmt.Printf("ctrl: Discarding sensor reading with quality %.2f\n", r.Quality)
+		}
+		if err != nil || r.Quality < c.MinSensorQuality {
+			// Never drive blind, but only report safety stop if readings
+			// don't resume quickly.
+			stop()
+			if since := time.Since(lastRead); since > c.StopMotionAfter && !safetyStop {
+				fmt.Printf("ctrl: No updates for %s, stopping motion\n", since)
+				safetyStop = true
+				c.update(func(s *Status) {
+					s.SafetyStop = true
+				}, SafetyStopEntered)
+			}
+			continue
+		}
+		dt := r.Time.Sub(lastRead).Seconds()
+		angle, lastRead = float64(r.Angle), r.Time
+
+		var events []EventType
+		if a := int32(math.Round(angle)); a != reported {
+			reported = a
+			events = append(events, PositionUpdate)
+		}
+		if safetyStop {
+			fmt.Println("ctrl: Sensor readings resumed")
+			safetyStop = false
+			events = append(events, SafetyStopCleared)
+		}
+
+		var fault error
+		// Stepping forward decreases angle, so does positive speed.
+		e := angle - float64(targetAngle)
+		deadband := c.PID.Deadband
+		if arrived {
+			deadband *= 2
+		}
+		switch {
+		case faulted || targetAngle == NoAngle:
+			stop()
+		case math.Abs(e) <= deadband:
+			stop()
+			if !arrived {
+				arrived = true
+				events = append(events, TargetReached)
+			}
+		default:
+			arrived = false
+			if !moving {
+				moving = true
+				progress, progressFrom = r.Time, angle
+				ctl.reset()
+				events = append(events, MoveStarted)
+			}
+			if math.Abs(angle-progressFrom) >= progressAngle {
+				progress, progressFrom = r.Time, angle
+			}
+			if since := r.Time.Sub(progress); since > c.PID.StallTime {
+				fault = fmt.Errorf("motor stalled: shaft didn't rotate for %s", since)
+				fmt.Printf("ctrl: %s\n", fault)
+				faulted = true
+				events = append(events, FaultEntered)
+				stop()
+			} else {
+				m.Drive(ctl.update(e, dt))
+			}
+		}
+		c.update(func(s *Status) {
+			s.Angle = reported
+			s.SafetyStop = false
+			s.Moving = moving
+			if fault != nil {
+				s.Fault = fault
+			}
+		}, events...)
+	}
+}
@@ -0,0 +1,55 @@
+package controller
+
+import "fmt"
+
+// stallDetector compares commanded steps with shaft rotation to detect
+// stalled motor or slipping coupling.
+type stallDetector struct {
+	// Number of steps over which progress is checked.
+	window int64
+	// Min fraction of expected rotation that shaft must make.
+	minProgress float64
+
+	// Reading progress is measured from.
+	base posUpdate
+	// Direction of last step.
+	dir int
+}
+
+func newStallDetector(window int64, minProgress float64) stallDetector {
+	return stallDetector{
+		window:      window,
+		minProgress: minProgress,
+		base:        posUpdate{angle: NoAngle},
+	}
+}
+
+// step records stepper direction. Reversing direction restarts measurement
+// as gearbox backlash would look like lack of progress.
+func (d *stallDetector) step(dir int) {
+	if dir != d.dir {
+		d.dir = dir
+		d.base.angle = NoAngle
+	}
+}
+
+// update adds new shaft reading and returns error if shaft didn't make
+// enough progress over the window.
+func (d *stallDetector) update(u posUpdate, stepsPerDegree float64) error {
+	if d.base.angle == NoAngle {
+		d.base = u
+		return nil
+	}
+	steps := abs(u.pos - d.base.pos)
+	if steps < d.window {
+		return nil
+	}
+	expected := float64(steps) / stepsPerDegree
+	// Stepping forward decreases angle.
+	moved := -float64(u.angle-d.base.angle) * float64(d.dir)
+	d.base = u
+	if moved < expected*d.minProgress {
+		return fmt.Errorf("motor stalled: shaft rotated %.0f° instead of %.0f° over %d steps", moved, expected, steps)
+	}
+	return nil
+}
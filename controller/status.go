@@ -0,0 +1,130 @@
+package controller
+
+import "time"
+
+// Status is a snapshot of controller state.
+type Status struct {
+	// Requested shaft angle. NoAngle if nothing was requested yet.
+	Target int32
+	// Last measured shaft angle. NoAngle if not known yet.
+	Angle int32
+	// Shaft is positioned at target.
+	AtTarget bool
+	// Stepper is moving.
+	Moving bool
+	// Motion is prevented because sensor readings are unavailable.
+	SafetyStop bool
+	// Error if controller stopped motor because of malfunction.
+	Fault error
+	// Current steps per degree estimate.
+	StepsPerDegree float64
+}
+
+type EventType int
+
+const (
+	// Stepper started moving towards target.
+	MoveStarted EventType = iota
+	// Shaft settled at target.
+	TargetReached
+	// Measured shaft angle changed.
+	PositionUpdate
+	// Motion stopped because sensor readings are unavailable.
+	SafetyStopEntered
+	// Sensor readings resumed.
+	SafetyStopCleared
+	// Motor stopped because of malfunction.
+	FaultEntered
+	// Fault cleared by new target.
+	FaultCleared
+)
+
+func (t EventType) String() string {
+	switch t {
+	case MoveStarted:
+		return "move started"
+	case TargetReached:
+		return "target reached"
+	case PositionUpdate:
+		return "position update"
+	case SafetyStopEntered:
+		return "safety stop entered"
+	case SafetyStopCleared:
+		return "safety stop cleared"
+	case FaultEntered:
+		return "fault entered"
+	case FaultCleared:
+		return "fault cleared"
+	}
+	return "unknown"
+}
+
+// Event notifies subscribers about controller state change.
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Status right after the change.
+	Status Status
+}
+
+// Size of subscriber channel buffer. Events are dropped if subscriber
+// falls behind.
+const subscriberBuffer = 16
+
+// Status returns consistent snapshot of controller state.
+func (c *Controller) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.statusLocked()
+}
+
+func (c *Controller) statusLocked() Status {
+	s := c.status
+	s.AtTarget = s.Target != NoAngle && s.Angle != NoAngle && abs(s.Target-s.Angle)*2 < c.PositionAccuracy
+	return s
+}
+
+// Subscribe returns channel delivering controller events and function to
+// cancel subscription. Events are never blocked on slow subscribers and
+// are dropped instead, so subscribers should use Status in events rather
+// than track changes.
+func (c *Controller) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subs[ch] = struct{}{}
+	return ch, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if _, ok := c.subs[ch]; ok {
+			delete(c.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// update changes status and notifies subscribers with events. Events are
+// only sent if any are provided.
+func (c *Controller) update(fn func(s *Status), events ...EventType) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fn(&c.status)
+	if len(events) == 0 {
+		return
+	}
+	now := time.Now()
+	s := c.statusLocked()
+	for _, t := range events {
+		e := Event{
+			Type:   t,
+			Time:   now,
+			Status: s,
+		}
+		for ch := range c.subs {
+			select {
+			case ch <- e:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package hass
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aliher1911/blinds/ui"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+type Config struct {
+	// Broker url e.g. tcp://localhost:1883. Empty url disables client.
+	Broker string `yaml:"broker"`
+	// Client id must be unique on broker, defaults to node id.
+	ClientID string `yaml:"client_id"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Unique id of the device used in topics and entity ids.
+	NodeID string `yaml:"node_id"`
+	// Entity name shown in Home Assistant.
+	Name string `yaml:"name"`
+	// Home Assistant discovery prefix.
+	DiscoveryPrefix string `yaml:"discovery_prefix"`
+	// Prefix of state and command topics.
+	TopicPrefix string `yaml:"topic_prefix"`
+	// How frequently state is checked for changes.
+	UpdateInterval time.Duration `yaml:"update_interval"`
+}
+
+func Defaults() Config {
+	return Config{
+		NodeID:          "blinds",
+		Name:            "Blinds",
+		DiscoveryPrefix: "homeassistant",
+		TopicPrefix:     "blinds",
+		UpdateInterval:  time.Second,
+	}
+}
+
+const (
+	online  = "online"
+	offline = "offline"
+	stop    = "STOP"
+)
+
+const (
+	qos            = 1
+	connectTimeout = 10 * time.Second
+	disconnectMs   = 250
+)
+
+// discovery is Home Assistant MQTT cover config.
+type discovery struct {
+	Name                string  `json:"name"`
+	UniqueID            string  `json:"unique_id"`
+	AvailabilityTopic   string  `json:"availability_topic"`
+	CommandTopic        string  `json:"command_topic"`
+	PayloadOpen         *string `json:"payload_open"`
+	PayloadClose        *string `json:"payload_close"`
+	PayloadStop         string  `json:"payload_stop"`
+	TiltStatusTopic     string  `json:"tilt_status_topic"`
+	TiltCommandTopic    string  `json:"tilt_command_topic"`
+	TiltMin             int32   `json:"tilt_min"`
+	TiltMax             int32   `json:"tilt_max"`
+	JSONAttributesTopic string  `json:"json_attributes_topic"`
+	Device              device  `json:"device"`
+}
+
+type device struct {
+	Identifiers []string `json:"identifiers"`
+	Name        string   `json:"name"`
+	Model       string   `json:"model"`
+}
+
+type attributes struct {
+	Target   int32  `json:"target"`
+	AtTarget bool   `json:"at_target"`
+	Auto     bool   `json:"auto"`
+	Fault    string `json:"fault"`
+}
+
+// Client publishes blinds state to MQTT broker as a Home Assistant cover
+// with tilt and applies tilt commands received from it.
+type Client struct {
+	cfg Config
+	doc ui.Document
+}
+
+func New(cfg Config, doc ui.Document) *Client {
+	return &Client{
+		cfg: cfg,
+		doc: doc,
+	}
+}
+
+func (c *Client) clientID() string {
+	if c.cfg.ClientID != "" {
+		return c.cfg.ClientID
+	}
+	return c.cfg.NodeID
+}
+
+func (c *Client) topic(name string) string {
+	return fmt.Sprintf("%s/%s/%s", c.cfg.TopicPrefix, c.cfg.NodeID, name)
+}
+
+// Run connects to broker and publishes updates until context is cancelled.
+// Should be started in a separate goroutine.
+func (c *Client) Run(ctx context.Context) error {
+	// Force republishing everything on (re)connect.
+	connectedC := make(chan interface{}, 1)
+	opts := mqtt.NewClientOptions().
+		AddBroker(c.cfg.Broker).
+		SetClientID(c.clientID()).
+		SetUsername(c.cfg.Username).
+		SetPassword(c.cfg.Password).
+		SetWill(c.topic("availability"), offline, qos, true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(func(cl mqtt.Client) {
+			fmt.Printf("hass: connected to %s\n", c.cfg.Broker)
+			c.subscribe(cl)
+			select {
+			case connectedC <- nil:
+			default:
+			}
+		}).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			fmt.Printf("hass: connection lost: %s\n", err)
+		})
+	cl := mqtt.NewClient(opts)
+	// With connect retry token completes only when connected, so we don't
+	// wait on it and rely on connect handler instead.
+	cl.Connect()
+	defer cl.Disconnect(disconnectMs)
+
+	var last attributes
+	var lastAngle int32
+	var lastAvailable, published bool
+	// Tilt range in published discovery config.
+	var lastMin, lastMax int32
+	var discovered bool
+	t := time.NewTicker(c.cfg.UpdateInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if cl.IsConnectionOpen() {
+				cl.Publish(c.topic("availability"), qos, true, offline).WaitTimeout(connectTimeout)
+			}
+			return ctx.Err()
+		case <-connectedC:
+			discovered = false
+			published = false
+		case <-t.C:
+		}
+		if !cl.IsConnectionOpen() {
+			continue
+		}
+
+		// Limits narrowed from device menu change tilt range.
+		if min, max := c.doc.Limits(); !discovered || min != lastMin || max != lastMax {
+			c.publish(cl, fmt.Sprintf("%s/cover/%s/config", c.cfg.DiscoveryPrefix, c.cfg.NodeID), c.discovery(min, max))
+			lastMin, lastMax = min, max
+			discovered = true
+		}
+
+		available := c.doc.Ready()
+		if !published || available != lastAvailable {
+			a := offline
+			if available {
+				a = online
+			}
+			c.publish(cl, c.topic("availability"), a)
+			lastAvailable = available
+		}
+		if !available {
+			published = true
+			continue
+		}
+		st := c.doc.GetState()
+		attrs := attributes{
+			Target:   st.SetAngle,
+			AtTarget: st.AtTarget,
+			Auto:     st.Auto,
+		}
+		if st.Fault != nil {
+			attrs.Fault = st.Fault.Error()
+		}
+		if !published || st.CurrentAngle != lastAngle {
+			c.publish(cl, c.topic("tilt"), strconv.Itoa(int(st.CurrentAngle)))
+			lastAngle = st.CurrentAngle
+		}
+		if !published || attrs != last {
+			c.publish(cl, c.topic("attributes"), attrs)
+			last = attrs
+		}
+		published = true
+	}
+}
+
+func (c *Client) subscribe(cl mqtt.Client) {
+	cl.Subscribe(c.topic("tilt/set"), qos, func(_ mqtt.Client, m mqtt.Message) {
+		angle, err := strconv.Atoi(strings.TrimSpace(string(m.Payload())))
+		if err != nil {
+			fmt.Printf("hass: invalid tilt command %q\n", m.Payload())
+			return
+		}
+		if !c.doc.Ready() {
+			fmt.Printf("hass: ignoring tilt command, blinds position is not known yet\n")
+			return
+		}
+		c.doc.SetAngle(int32(angle))
+	})
+	cl.Subscribe(c.topic("command"), qos, func(_ mqtt.Client, m mqtt.Message) {
+		switch cmd := string(m.Payload()); cmd {
+		case stop:
+			c.doc.Stop()
+		default:
+			fmt.Printf("hass: unsupported command %q\n", cmd)
+		}
+	})
+}
+
+func (c *Client) discovery(min, max int32) discovery {
+	return discovery{
+		Name:                c.cfg.Name,
+		UniqueID:            c.cfg.NodeID,
+		AvailabilityTopic:   c.topic("availability"),
+		CommandTopic:        c.topic("command"),
+		PayloadStop:         stop,
+		TiltStatusTopic:     c.topic("tilt"),
+		TiltCommandTopic:    c.topic("tilt/set"),
+		TiltMin:             min,
+		TiltMax:             max,
+		JSONAttributesTopic: c.topic("attributes"),
+		Device: device{
+			Identifiers: []string{c.cfg.NodeID},
+			Name:        c.cfg.Name,
+			Model:       "blinds",
+		},
+	}
+}
+
+// publish sends retained message. Values that are not strings are sent as
+// JSON.
+func (c *Client) publish(cl mqtt.Client, topic string, v interface{}) {
+	payload, ok := v.(string)
+	if !ok {
+		b, err := json.Marshal(v)
+		if err != nil {
+			fmt.Printf("hass: failed to encode %s: %s\n", topic, err)
+			return
+		}
+		payload = string(b)
+	}
+	t := cl.Publish(topic, qos, true, payload)
+	go func() {
+		if t.WaitTimeout(connectTimeout) && t.Error() != nil {
+			fmt.Printf("hass: failed to publish %s: %s\n", topic, t.Error())
+		}
+	}()
+}
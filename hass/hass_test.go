@@ -0,0 +1,310 @@
+package hass_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aliher1911/blinds/hass"
+	"github.com/aliher1911/blinds/ui"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+const waitTimeout = 5 * time.Second
+
+type message struct {
+	topic   string
+	payload string
+}
+
+// broker is minimal MQTT broker accepting single client. It records
+// published messages and sends messages to subscribed topics on request.
+type broker struct {
+	t  *testing.T
+	ln net.Listener
+
+	clientIDC   chan string
+	subscribedC chan string
+	publishedC  chan message
+	// Topics client subscribed to so far.
+	subscribed map[string]bool
+
+	mu   sync.Mutex
+	conn net.Conn
+	id   uint16
+}
+
+func newBroker(t *testing.T) *broker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	b := &broker{
+		t:           t,
+		ln:          ln,
+		clientIDC:   make(chan string, 1),
+		subscribedC: make(chan string, 10),
+		publishedC:  make(chan message, 100),
+		subscribed:  make(map[string]bool),
+	}
+	go b.serve()
+	t.Cleanup(func() {
+		ln.Close()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.conn != nil {
+			b.conn.Close()
+		}
+	})
+	return b
+}
+
+func (b *broker) url() string {
+	return "tcp://" + b.ln.Addr().String()
+}
+
+func (b *broker) serve() {
+	conn, err := b.ln.Accept()
+	if err != nil {
+		return
+	}
+	b.mu.Lock()
+	b.conn = conn
+	b.mu.Unlock()
+	for {
+		p, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		switch p := p.(type) {
+		case *packets.ConnectPacket:
+			b.clientIDC <- p.ClientIdentifier
+			b.write(packets.NewControlPacket(packets.Connack))
+		case *packets.SubscribePacket:
+			ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			ack.MessageID = p.MessageID
+			ack.ReturnCodes = p.Qoss
+			b.write(ack)
+			for _, topic := range p.Topics {
+				b.subscribedC <- topic
+			}
+		case *packets.PublishPacket:
+			if p.Qos > 0 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				b.write(ack)
+			}
+			b.publishedC <- message{topic: p.TopicName, payload: string(p.Payload)}
+		case *packets.PingreqPacket:
+			b.write(packets.NewControlPacket(packets.Pingresp))
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+func (b *broker) write(p packets.ControlPacket) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := p.Write(b.conn); err != nil {
+		b.t.Errorf("failed to write %s: %s", p, err)
+	}
+}
+
+// send publishes message to client.
+func (b *broker) send(topic, payload string) {
+	p := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	p.TopicName = topic
+	p.Payload = []byte(payload)
+	p.Qos = 1
+	b.mu.Lock()
+	b.id++
+	p.MessageID = b.id
+	b.mu.Unlock()
+	b.write(p)
+}
+
+// waitFor returns payload of next message published to topic.
+func (b *broker) waitFor(topic string) string {
+	b.t.Helper()
+	deadline := time.After(waitTimeout)
+	for {
+		select {
+		case m := <-b.publishedC:
+			if m.topic == topic {
+				return m.payload
+			}
+		case <-deadline:
+			b.t.Fatalf("no message published to %s", topic)
+		}
+	}
+}
+
+// waitSubscribed waits for client to subscribe to topic.
+func (b *broker) waitSubscribed(topic string) {
+	b.t.Helper()
+	deadline := time.After(waitTimeout)
+	for !b.subscribed[topic] {
+		select {
+		case s := <-b.subscribedC:
+			b.subscribed[s] = true
+		case <-deadline:
+			b.t.Fatalf("client didn't subscribe to %s", topic)
+		}
+	}
+}
+
+type document struct {
+	mu       sync.Mutex
+	state    ui.State
+	min, max int32
+
+	setC  chan int32
+	stopC chan interface{}
+}
+
+func (d *document) SetAngle(angle int32) {
+	d.setC <- angle
+}
+
+func (d *document) SetAuto(auto bool) {}
+
+func (d *document) GetState() ui.State {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.state
+}
+
+func (d *document) SetSettings(s ui.Settings) {}
+
+func (d *document) Stop() {
+	d.stopC <- nil
+}
+
+func (d *document) Ready() bool {
+	return true
+}
+
+func (d *document) Limits() (int32, int32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.min, d.max
+}
+
+func (d *document) setLimits(min, max int32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.min, d.max = min, max
+}
+
+func (d *document) setState(s ui.State) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.state = s
+}
+
+func TestClient(t *testing.T) {
+	b := newBroker(t)
+	doc := &document{
+		state: ui.State{SetAngle: 20, CurrentAngle: 20, AtTarget: true, Ready: true},
+		min:   -140,
+		max:   140,
+		setC:  make(chan int32, 1),
+		stopC: make(chan interface{}, 1),
+	}
+	cfg := hass.Defaults()
+	cfg.Broker = b.url()
+	cfg.NodeID = "window"
+	cfg.UpdateInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	doneC := make(chan interface{})
+	go func() {
+		defer close(doneC)
+		hass.New(cfg, doc).Run(ctx)
+	}()
+
+	select {
+	case id := <-b.clientIDC:
+		if id != "window" {
+			t.Errorf("expected client id to default to node id, got %q", id)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("client didn't connect")
+	}
+
+	var disc map[string]interface{}
+	if err := json.Unmarshal([]byte(b.waitFor("homeassistant/cover/window/config")), &disc); err != nil {
+		t.Fatalf("invalid discovery message: %s", err)
+	}
+	for k, v := range map[string]interface{}{
+		"unique_id":          "window",
+		"availability_topic": "blinds/window/availability",
+		"command_topic":      "blinds/window/command",
+		"payload_stop":       "STOP",
+		"tilt_status_topic":  "blinds/window/tilt",
+		"tilt_command_topic": "blinds/window/tilt/set",
+		"tilt_min":           float64(-140),
+		"tilt_max":           float64(140),
+	} {
+		if disc[k] != v {
+			t.Errorf("expected discovery %s to be %v, got %v", k, v, disc[k])
+		}
+	}
+	if a := b.waitFor("blinds/window/availability"); a != "online" {
+		t.Errorf("expected online availability, got %q", a)
+	}
+	if tilt := b.waitFor("blinds/window/tilt"); tilt != "20" {
+		t.Errorf("expected tilt 20, got %q", tilt)
+	}
+
+	b.waitSubscribed("blinds/window/tilt/set")
+	b.send("blinds/window/tilt/set", "30")
+	select {
+	case angle := <-doc.setC:
+		if angle != 30 {
+			t.Errorf("expected angle 30 to be set, got %d", angle)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("tilt command wasn't applied")
+	}
+	doc.setState(ui.State{SetAngle: 30, CurrentAngle: 25, Ready: true})
+	if tilt := b.waitFor("blinds/window/tilt"); tilt != "25" {
+		t.Errorf("expected tilt 25, got %q", tilt)
+	}
+	var attrs map[string]interface{}
+	if err := json.Unmarshal([]byte(b.waitFor("blinds/window/attributes")), &attrs); err != nil {
+		t.Fatalf("invalid attributes message: %s", err)
+	}
+	if attrs["target"] != float64(30) || attrs["at_target"] != false {
+		t.Errorf("unexpected attributes %v", attrs)
+	}
+
+	// Limits changed from device menu are published with discovery.
+	doc.setLimits(-90, 60)
+	if err := json.Unmarshal([]byte(b.waitFor("homeassistant/cover/window/config")), &disc); err != nil {
+		t.Fatalf("invalid discovery message: %s", err)
+	}
+	if disc["tilt_min"] != float64(-90) || disc["tilt_max"] != float64(60) {
+		t.Errorf("expected tilt range [-90, 60], got [%v, %v]", disc["tilt_min"], disc["tilt_max"])
+	}
+
+	b.waitSubscribed("blinds/window/command")
+	b.send("blinds/window/command", "STOP")
+	select {
+	case <-doc.stopC:
+	case <-time.After(waitTimeout):
+		t.Fatal("stop command wasn't applied")
+	}
+
+	cancel()
+	if a := b.waitFor("blinds/window/availability"); a != "offline" {
+		t.Errorf("expected offline availability on exit, got %q", a)
+	}
+	<-doneC
+}
@@ -1,8 +1,8 @@
 package i2cdev
 
 type Conf struct {
-	Bus  int
-	Addr uint8
+	Bus  int   `yaml:"-"`
+	Addr uint8 `yaml:"addr"`
 }
 
 func (c *Conf) Default(a uint8) {
@@ -0,0 +1,9 @@
+package i2cdev
+
+// Interrupt is an interrupt line of a device.
+type Interrupt interface {
+	// Read is true if interrupt is asserted.
+	Read() bool
+	// EdgeDetected is true if interrupt fired since last check.
+	EdgeDetected() bool
+}
@@ -0,0 +1,165 @@
+package input
+
+import (
+	"math"
+	"time"
+)
+
+// Forever is duration of animations that never end.
+const Forever = time.Duration(1<<63 - 1)
+
+// Animation computes LED color over time.
+type Animation interface {
+	// Duration of animation, Forever if it never ends.
+	Duration() time.Duration
+	// Frame returns color at time t since animation start and time until
+	// color changes next, zero if it changes continuously.
+	Frame(t time.Duration) (Color, time.Duration)
+}
+
+// Easing maps linear progress in [0, 1] to animation progress.
+type Easing func(p float64) float64
+
+func Linear(p float64) float64 {
+	return p
+}
+
+// EaseInOut starts and ends transition slowly.
+func EaseInOut(p float64) float64 {
+	return (1 - math.Cos(p*math.Pi)) / 2
+}
+
+// Blend mixes colors component wise, f of 0 is c and 1 is to.
+func (c Color) Blend(to Color, f float64) Color {
+	mix := func(offset int) Color {
+		a := float64((c >> offset) & 0xff)
+		b := float64((to >> offset) & 0xff)
+		return Color(math.Round(a+(b-a)*f)) << offset
+	}
+	return mix(16) | mix(8) | mix(0)
+}
+
+type solid struct {
+	c Color
+	d time.Duration
+}
+
+// Solid shows color for duration.
+func Solid(c Color, d time.Duration) Animation {
+	return solid{c: c, d: d}
+}
+
+func (s solid) Duration() time.Duration {
+	return s.d
+}
+
+func (s solid) Frame(t time.Duration) (Color, time.Duration) {
+	if s.d == Forever {
+		return s.c, Forever
+	}
+	return s.c, s.d - t
+}
+
+type fade struct {
+	from, to Color
+	d        time.Duration
+	ease     Easing
+}
+
+// Fade gradually changes color over duration.
+func Fade(from, to Color, d time.Duration, ease Easing) Animation {
+	return fade{from: from, to: to, d: d, ease: ease}
+}
+
+func (f fade) Duration() time.Duration {
+	return f.d
+}
+
+func (f fade) Frame(t time.Duration) (Color, time.Duration) {
+	return f.from.Blend(f.to, f.ease(float64(t)/float64(f.d))), 0
+}
+
+type breathe struct {
+	c      Color
+	period time.Duration
+	d      time.Duration
+}
+
+// Breathe smoothly pulses color from off to full brightness and back once
+// per period.
+func Breathe(c Color, period, d time.Duration) Animation {
+	return breathe{c: c, period: period, d: d}
+}
+
+func (b breathe) Duration() time.Duration {
+	return b.d
+}
+
+func (b breathe) Frame(t time.Duration) (Color, time.Duration) {
+	p := float64(t%b.period) / float64(b.period)
+	return Off.Blend(b.c, (1-math.Cos(2*math.Pi*p))/2), 0
+}
+
+// Blink flashes color n times. Color is on for half of the period.
+func Blink(c Color, n int, period time.Duration) Animation {
+	return Loop(Sequence(Solid(c, period/2), Solid(Off, period-period/2)), n)
+}
+
+type sequence struct {
+	items []Animation
+	d     time.Duration
+}
+
+// Sequence plays animations one after another. Animations after one that
+// runs forever are never played.
+func Sequence(items ...Animation) Animation {
+	s := sequence{items: items}
+	for _, a := range items {
+		if a.Duration() == Forever {
+			s.d = Forever
+			break
+		}
+		s.d += a.Duration()
+	}
+	return s
+}
+
+func (s sequence) Duration() time.Duration {
+	return s.d
+}
+
+func (s sequence) Frame(t time.Duration) (Color, time.Duration) {
+	for _, a := range s.items {
+		if d := a.Duration(); t >= d {
+			t -= d
+			continue
+		}
+		return a.Frame(t)
+	}
+	return Off, Forever
+}
+
+type loop struct {
+	a Animation
+	n int
+}
+
+// Loop repeats animation n times, zero repeats it forever.
+func Loop(a Animation, n int) Animation {
+	return loop{a: a, n: n}
+}
+
+func (l loop) Duration() time.Duration {
+	d := l.a.Duration()
+	switch {
+	case d == 0:
+		return 0
+	case l.n == 0 || d == Forever || d > Forever/time.Duration(l.n):
+		return Forever
+	}
+	return d * time.Duration(l.n)
+}
+
+func (l loop) Frame(t time.Duration) (Color, time.Duration) {
+	return l.a.Frame(t % l.a.Duration())
+}
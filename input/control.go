@@ -0,0 +1,15 @@
+package input
+
+// Control is a rotary encoder with a push button and an RGB LED.
+type Control interface {
+	// Read absolute encoder position.
+	Position() (int, error)
+	// Read delta since last read and reset it.
+	Delta() (int, error)
+	SetPosition(newPos int) error
+	// Retrieve button state and reset interrupt flag.
+	Button() (button, interrupt bool, err error)
+	// Set LED color.
+	LED(c Color) error
+	Close()
+}
@@ -5,33 +5,65 @@ import (
 	"time"
 )
 
+// Layer is a priority of LED animation. Animation on a higher layer hides
+// lower ones until it ends, lower layers keep running meanwhile.
+type Layer int
+
+const (
+	// Background indication of device state.
+	LayerStatus Layer = iota
+	// Feedback to user input.
+	LayerUI
+	// Faults that override everything else.
+	LayerAlert
+	layerCount
+)
+
+// LedOp plays animation on a layer replacing animation that layer is
+// currently playing.
 type LedOp struct {
-	c Color
-	t time.Duration
-	n *LedOp
+	layer Layer
+	a     Animation
 }
 
+// NewLedOp creates a sequence of solid colors on UI layer. Ops in next
+// are appended after the color regardless of their layers.
 func NewLedOp(c Color, t time.Duration, next ...*LedOp) *LedOp {
-	root := &LedOp{
-		c: c,
-		t: t,
-	}
-	last := root
+	items := []Animation{Solid(c, t)}
 	for _, n := range next {
-		last.n = n
-		for nn := n.n; nn != nil; nn = nn.n {
-			last = nn
+		if n.a != nil {
+			items = append(items, n.a)
 		}
 	}
-	return root
+	return Play(LayerUI, Sequence(items...))
 }
 
+// Play creates op that starts animation on a layer.
+func Play(l Layer, a Animation) *LedOp {
+	return &LedOp{
+		layer: l,
+		a:     a,
+	}
+}
+
+// Clear creates op that stops animation on a layer.
+func Clear(l Layer) *LedOp {
+	return &LedOp{
+		layer: l,
+	}
+}
+
+// Min time between LED updates. Each update is two seesaw writes on i2c bus
+// shared with sensor, so we keep the rate well below what link could
+// sustain to leave room for sensor reads.
+const minFrameT = 40 * time.Millisecond
+
 type LED struct {
-	r    *Rotary
+	r    Control
 	outC chan *LedOp
 }
 
-func NewLED(r *Rotary) (*LED, chan *LedOp) {
+func NewLED(r Control) (*LED, chan *LedOp) {
 	c := make(chan *LedOp, 10)
 	return &LED{
 		r:    r,
@@ -39,36 +71,65 @@ func NewLED(r *Rotary) (*LED, chan *LedOp) {
 	}, c
 }
 
+type playing struct {
+	a     Animation
+	start time.Time
+}
+
 // Run is a LED work loop and should be started in a separate
 // goroutine.
 func (l *LED) Run(ctx context.Context) error {
-	never := time.Duration(1<<63 - 1)
-	t := time.NewTimer(never)
-	next := &LedOp{
-		c: Off,
-		t: never,
-	}
+	var layers [layerCount]playing
+	t := time.NewTimer(Forever)
+	defer t.Stop()
+	current := Off
+	var lastFrame time.Time
 	for {
 		select {
 		case <-ctx.Done():
-			t.Stop()
 			return ctx.Err()
-		case next = <-l.outC:
+		case op := <-l.outC:
+			layers[op.layer] = playing{a: op.a, start: time.Now()}
 			if !t.Stop() {
-				<-t.C
+				select {
+				case <-t.C:
+				default:
+				}
 			}
 		case <-t.C:
 		}
-		l.r.LED(next.c)
-		t.Reset(next.t)
-		if next.n != nil {
-			next = next.n
-		} else {
-			// Turn off at the end of sequence.
-			next = &LedOp{
-				c: Off,
-				t: never,
-			}
+		now := time.Now()
+		if next := lastFrame.Add(minFrameT); now.Before(next) {
+			t.Reset(next.Sub(now))
+			continue
+		}
+		c, wait := frame(&layers, now)
+		if c != current {
+			l.r.LED(c)
+			current = c
+			lastFrame = now
+		}
+		if wait < minFrameT {
+			wait = minFrameT
+		}
+		t.Reset(wait)
+	}
+}
+
+// frame finds color of the top running layer and time until it changes.
+// Finished animations are removed. LED is off when nothing is playing.
+func frame(layers *[layerCount]playing, now time.Time) (Color, time.Duration) {
+	for i := layerCount - 1; i >= 0; i-- {
+		p := &layers[i]
+		if p.a == nil {
+			continue
+		}
+		elapsed := now.Sub(p.start)
+		if elapsed >= p.a.Duration() {
+			p.a = nil
+			continue
 		}
+		return p.a.Frame(elapsed)
 	}
+	return Off, Forever
 }
@@ -63,6 +63,7 @@ const (
 	Blue    Color = 0x0000ff
 	Cyan    Color = 0xff00ff
 	White   Color = 0xffffff
+	Amber   Color = 0xbfff00
 )
 
 const (
@@ -104,9 +105,9 @@ const buttonPin = 24
 const defaultAddr = 0x36
 
 type Conf struct {
-	i2cdev.Conf
-	NeopixelPin int
-	ButtonPin   int
+	i2cdev.Conf `yaml:",inline"`
+	NeopixelPin int `yaml:"neopixel_pin"`
+	ButtonPin   int `yaml:"button_pin"`
 }
 
 func Default(bus uint) Conf {
@@ -121,7 +122,7 @@ func Default(bus uint) Conf {
 }
 
 func NewRotary(c Conf) (*Rotary, error) {
-	bus, err := i2c.NewI2C(c.Addr, 1)
+	bus, err := i2c.NewI2C(c.Addr, c.Bus)
 	if err != nil {
 		return nil, err
 	}
@@ -174,7 +175,7 @@ func (r *Rotary) Position() (int, error) {
 	if err := r.read(ENCODER_BASE, ENCODER_POSITION, buf, delay); err != nil {
 		return 0, err
 	}
-	return int(binary.BigEndian.Uint32(buf)), nil
+	return int(int32(binary.BigEndian.Uint32(buf))), nil
 }
 
 // Read delta since last read and reset it.
@@ -183,11 +184,14 @@ func (r *Rotary) Delta() (int, error) {
 	if err := r.read(ENCODER_BASE, ENCODER_DELTA, buf, delay); err != nil {
 		return 0, err
 	}
-	return int(binary.BigEndian.Uint32(buf)), nil
+	return int(int32(binary.BigEndian.Uint32(buf))), nil
 }
 
+// Overwrite absolute encoder position.
 func (r *Rotary) SetPosition(newPos int) error {
-	return nil
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, uint32(int32(newPos)))
+	return r.write(ENCODER_BASE, ENCODER_POSITION, buf)
 }
 
 // Retrieve button state and reset interrupt flag.
@@ -8,6 +8,7 @@ import (
 	"os/signal"
 
 	"github.com/aliher1911/blinds/cli"
+	"github.com/aliher1911/blinds/config"
 
 	logger "github.com/d2r2/go-logger"
 	rpio "github.com/stianeikeland/go-rpio/v4"
@@ -26,41 +27,104 @@ func LogInterrupts(ctx context.Context, intr <-chan interface{}) {
 
 func main() {
 	logger.ChangePackageLogLevel("i2c", logger.InfoLevel)
+	var configPath string
 	var bus uint
 	var angle int
 	var baseAngle int
+	var simulate bool
+	var httpAddr string
+	var statePath string
+	var mqttBroker, mqttNode, mqttUser, mqttPassword string
 
+	flag.StringVar(&configPath, "config", "", "path to YAML config file, defaults are used if not set")
 	flag.UintVar(&bus, "bus", 1, "provide i2c bus id")
 	flag.IntVar(&angle, "angle", 0, "rotate to desired angle")
 	flag.IntVar(&baseAngle, "base-angle", 0, "physical angle that is treated as zero (-180, 180)")
+	flag.StringVar(&httpAddr, "http", "", "address to serve REST API on in service mode, e.g. :8080")
+	flag.StringVar(&mqttBroker, "mqtt", "", "MQTT broker url to publish Home Assistant cover to in service mode, e.g. tcp://localhost:1883")
+	flag.StringVar(&mqttNode, "mqtt-node", "", "unique id of blinds in MQTT topics and Home Assistant")
+	flag.StringVar(&mqttUser, "mqtt-user", "", "MQTT user name")
+	flag.StringVar(&mqttPassword, "mqtt-password", "", "MQTT password")
+	flag.StringVar(&statePath, "state", "", "path to file to keep blinds state across restarts in service mode")
+	flag.BoolVar(&simulate, "sim", false, "run against simulated hardware instead of GPIO and i2c")
 
 	flag.Parse()
 
+	cfg := config.Defaults()
+	if configPath != "" {
+		var err error
+		if cfg, err = config.Load(configPath); err != nil {
+			fmt.Printf("failed to load config: %s\n", err)
+			return
+		}
+	}
+	// Flags explicitly set on command line take precedence over config file.
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "bus":
+			cfg.Bus = bus
+		case "base-angle":
+			cfg.BaseAngle = int32(baseAngle)
+		case "http":
+			cfg.HTTPAddr = httpAddr
+		case "state":
+			cfg.StateFile = statePath
+		case "mqtt":
+			cfg.MQTT.Broker = mqttBroker
+		case "mqtt-node":
+			cfg.MQTT.NodeID = mqttNode
+		case "mqtt-user":
+			cfg.MQTT.Username = mqttUser
+		case "mqtt-password":
+			cfg.MQTT.Password = mqttPassword
+		}
+	})
+	cfg.Propagate()
+	if err := cfg.Validate(); err != nil {
+		fmt.Printf("invalid configuration: %s\n", err)
+		return
+	}
+
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, os.Interrupt)
 
-	err := rpio.Open()
-	if err != nil {
-		fmt.Printf("failed to open GPIO: %s\n", err)
+	if flag.Arg(0) == "config" {
+		if err := cfg.Write(os.Stdout); err != nil {
+			fmt.Printf("failed to write config: %s\n", err)
+		}
 		return
 	}
-	defer rpio.Close()
+
+	var hw cli.Hardware
+	if simulate {
+		hw = cli.NewSimulator(cfg.Sim, cfg.Stepper)
+	} else {
+		err := rpio.Open()
+		if err != nil {
+			fmt.Printf("failed to open GPIO: %s\n", err)
+			return
+		}
+		defer rpio.Close()
+		hw = cli.NewDevices(cfg)
+	}
 
 	switch flag.Arg(0) {
 	case "read":
-		cli.GetAngle(bus)
+		cli.GetAngle(hw)
 	case "set":
-		cli.SetAngle(bus, int32(baseAngle), int32(angle))
+		cli.SetAngle(hw, cfg, int32(angle))
 	case "ui-test":
-		cli.CliTest(bus, sigs)
+		cli.CliTest(hw, sigs)
 	case "service":
-		cli.Service(bus, int32(baseAngle), sigs)
+		cli.Service(hw, cfg, sigs)
 	case "int-debug":
-		cli.IntDebug(bus, sigs)
+		cli.IntDebug(hw, sigs)
 	case "LED":
-		cli.LEDDemo(bus, sigs)
+		cli.LEDDemo(hw, sigs)
 	case "ui-demo":
-		cli.UIDemo(bus, sigs)
+		cli.UIDemo(hw, cfg.UI, sigs)
+	case "calibrate":
+		cli.Calibrate(hw, cfg, configPath, sigs)
 	case "help":
 		fallthrough
 	case "":
@@ -73,6 +137,10 @@ service   - run service which sets shaft angle in response to rotary controls
 int-debug - debug interrupt handling
 LED       - run test LED output
 ui-demo   - run ui controller test
+config    - print effective configuration in config file format
+calibrate - find base angle, angle limits and steps per degree using rotary and save them to config
+
+use -sim flag to run commands against simulated hardware
 `)
 	default:
 		fmt.Printf("unknown command: %s\n", flag.Arg(0))
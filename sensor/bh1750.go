@@ -0,0 +1,86 @@
+package sensor
+
+import (
+	"fmt"
+
+	"github.com/aliher1911/blinds/i2c"
+
+	"github.com/aliher1911/go-i2c"
+)
+
+// BH1750 is ambient light sensor. It has no registers, device is controlled
+// by writing opcodes and measurement is read as a 16 bit value.
+type BH1750 struct {
+	dev *i2cdev.BulkDevice
+}
+
+const (
+	lightDataH int = iota
+	lightDataL
+)
+
+var lightReadRegs = i2cdev.Registers{
+	// DATA
+	i2cdev.Field{0, 0, 0b11111111},
+	i2cdev.Field{1, 0, 0b11111111},
+}
+
+const (
+	lightOpcode int = iota
+)
+
+var lightWriteRegs = i2cdev.Registers{
+	// OPCODE
+	i2cdev.Field{0, 0, 0b11111111},
+}
+
+const (
+	opPowerOn = 0x01
+	// Continuous measurement with 1 lx resolution every 120ms.
+	opContinuousHRes = 0x10
+)
+
+const defaultLightAddr = 0x23
+
+func DefaultLight(bus uint) i2cdev.Conf {
+	return i2cdev.Conf{
+		Addr: defaultLightAddr,
+		Bus:  int(bus),
+	}
+}
+
+func NewBH1750(conf i2cdev.Conf) (*BH1750, error) {
+	fmt.Printf("creating light sensor\n")
+
+	bus, err := i2c.NewI2C(conf.Addr, conf.Bus)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &BH1750{
+		dev: i2cdev.NewBulkDevice(bus, lightReadRegs, lightWriteRegs),
+	}
+	for _, op := range []byte{opPowerOn, opContinuousHRes} {
+		l.dev.WriteReg(lightOpcode, op)
+		if err := l.dev.WriteBus(); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Counts per lux with default measurement time.
+const luxScale = 1.2
+
+func (l *BH1750) Lux() (float32, error) {
+	if err := l.dev.ReadBus(); err != nil {
+		return 0, err
+	}
+	raw := uint16(l.dev.ReadReg(lightDataH))<<8 | uint16(l.dev.ReadReg(lightDataL))
+	return float32(raw) / luxScale, nil
+}
+
+func (l *BH1750) Close() {
+	l.dev.Close()
+}
@@ -0,0 +1,7 @@
+package sensor
+
+// Field is a 3-axis magnetic field sensor.
+type Field interface {
+	// Read returns x, y and z components of the field.
+	Read() (float32, float32, float32, error)
+}
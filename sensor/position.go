@@ -1,25 +1,36 @@
 package sensor
 
-import "math"
+import (
+	"math"
+	"time"
+)
 
+// Field strength in xy plane above which we fully trust the angle. Weaker
+// field means magnet is misaligned or too far from the sensor and angle
+// becomes noisy.
+const fullQualityField = 5000
+
+// Position is an AngleSensor that computes shaft angle from direction of
+// the field of a magnet attached to the shaft.
 type Position struct {
-	m         *Magnetometer
+	m         Field
 	baseAngle float32
 }
 
 // Angle is typically the missle of the range.
 // For our case is the horizontal position.
-func NewPositionSensor(m *Magnetometer, angle float32) Position {
+func NewPositionSensor(m Field, angle float32) Position {
 	return Position{
 		m:         m,
 		baseAngle: angle,
 	}
 }
 
-func (p Position) Read() (float32, error) {
+func (p Position) Read() (Reading, error) {
+	now := time.Now()
 	x, y, _, err := p.m.Read()
 	if err != nil {
-		return 0, err
+		return Reading{}, err
 	}
 	sensorRadians := math.Atan2(float64(y), float64(x))
 	sensorDegrees := sensorRadians * 180 / math.Pi
@@ -30,5 +41,10 @@ func (p Position) Read() (float32, error) {
 	case shaftAngle < -180:
 		shaftAngle += 360
 	}
-	return float32(shaftAngle), nil
+	quality := math.Min(math.Hypot(float64(x), float64(y))/fullQualityField, 1)
+	return Reading{
+		Angle:   float32(shaftAngle),
+		Quality: float32(quality),
+		Time:    now,
+	}, nil
 }
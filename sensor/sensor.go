@@ -0,0 +1,24 @@
+package sensor
+
+import "time"
+
+// Reading is a single shaft angle measurement.
+type Reading struct {
+	// Shaft angle in degrees in [-180, 180] range.
+	Angle float32
+	// Confidence in reading in [0, 1] range. 0 means reading is unusable.
+	Quality float32
+	// Time when reading was taken.
+	Time time.Time
+}
+
+// AngleSensor reads absolute shaft angle.
+type AngleSensor interface {
+	Read() (Reading, error)
+}
+
+// LightSensor measures ambient light.
+type LightSensor interface {
+	// Lux returns illuminance in lux.
+	Lux() (float32, error)
+}
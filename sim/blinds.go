@@ -0,0 +1,154 @@
+package sim
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+
+	"github.com/aliher1911/blinds/actuator"
+)
+
+type Config struct {
+	// Motor steps per degree of output shaft.
+	StepsPerDegree float64 `yaml:"steps_per_degree"`
+	// Free play in gearbox in degrees.
+	Backlash float64 `yaml:"backlash"`
+	// Standard deviation of sensor angle noise in degrees.
+	Noise float64 `yaml:"noise"`
+	// Mechanical end stops of the slats in degrees.
+	MinStop float64 `yaml:"min_stop"`
+	MaxStop float64 `yaml:"max_stop"`
+	// Probability of motor missing a step.
+	MissedSteps float64 `yaml:"missed_steps"`
+	// Initial angle of the shaft.
+	Angle float64 `yaml:"angle"`
+	// Strength of the magnet field seen by sensor.
+	Field float64 `yaml:"field"`
+	// Initial ambient light level in lux.
+	Lux float32 `yaml:"lux"`
+	// Shaft speed of DC motor at full duty in degrees/s.
+	DCSpeed float64 `yaml:"dc_speed"`
+	// Min duty of DC motor that overcomes friction.
+	DCMinDuty float64 `yaml:"dc_min_duty"`
+}
+
+func Defaults() Config {
+	return Config{
+		StepsPerDegree: 180,
+		Backlash:       2,
+		Noise:          0.3,
+		MinStop:        -150,
+		MaxStop:        150,
+		MissedSteps:    0.001,
+		Angle:          0,
+		Field:          20000,
+		Lux:            1000,
+		DCSpeed:        60,
+		DCMinDuty:      0.2,
+	}
+}
+
+// Blinds simulates stepper with gearbox rotating slats and magnetometer
+// measuring angle of output shaft. Sensor zero is aligned with shaft zero.
+type Blinds struct {
+	cfg Config
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+	// Angle of gearbox input converted to output degrees.
+	motor float64
+	// Angle of output shaft.
+	shaft float64
+	// Coils are energized by steps or hold and released by power off.
+	powered bool
+	// Last step was blocked by end stop.
+	blocked bool
+}
+
+func NewBlinds(cfg Config) *Blinds {
+	return &Blinds{
+		cfg:   cfg,
+		rnd:   rand.New(rand.NewSource(rand.Int63())),
+		motor: cfg.Angle,
+		shaft: cfg.Angle,
+	}
+}
+
+// Step moves motor. Positive steps rotate shaft clockwise if looking from
+// sensor side which decreases measured angle.
+func (b *Blinds) Step(delta int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.powered = true
+	b.blocked = false
+	if b.rnd.Float64() < b.cfg.MissedSteps {
+		return
+	}
+	b.motor -= float64(delta) / b.cfg.StepsPerDegree
+
+	// Shaft only follows motor when gearbox play is taken up.
+	play := b.cfg.Backlash / 2
+	switch {
+	case b.motor-b.shaft > play:
+		b.shaft = b.motor - play
+	case b.shaft-b.motor > play:
+		b.shaft = b.motor + play
+	}
+
+	// Slats can't go past the stops and motor stalls against them.
+	switch {
+	case b.shaft > b.cfg.MaxStop:
+		b.shaft = b.cfg.MaxStop
+		b.motor = math.Min(b.motor, b.shaft+play)
+		b.blocked = true
+	case b.shaft < b.cfg.MinStop:
+		b.shaft = b.cfg.MinStop
+		b.motor = math.Max(b.motor, b.shaft-play)
+		b.blocked = true
+	}
+}
+
+// Blocked is true if powered motor is pushing against end stop.
+func (b *Blinds) Blocked() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.powered && b.blocked
+}
+
+func (b *Blinds) PowerOn() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.powered = true
+}
+
+func (b *Blinds) PowerOff() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.powered = false
+}
+
+func (b *Blinds) Capabilities() actuator.Capabilities {
+	return actuator.Capabilities{
+		Holding: true,
+	}
+}
+
+// Read returns magnetometer reading of the magnet attached to the shaft.
+func (b *Blinds) Read() (float32, float32, float32, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	a := (b.shaft + b.rnd.NormFloat64()*b.cfg.Noise) * math.Pi / 180
+	return float32(b.cfg.Field * math.Cos(a)), float32(b.cfg.Field * math.Sin(a)), 0, nil
+}
+
+func (b *Blinds) Close() {
+}
+
+// Angle returns true angle of the shaft.
+func (b *Blinds) Angle() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.shaft
+}
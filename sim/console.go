@@ -0,0 +1,73 @@
+package sim
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const consoleHelp = `sim: rotary commands:
+  +N / -N - turn encoder N clicks (N defaults to 1)
+  press   - press and hold button
+  release - release button
+  click   - press and release button
+  lux=N   - set ambient light level to N lx
+`
+
+const clickTime = 50 * time.Millisecond
+
+// RunConsole reads rotary and light commands from input until it is
+// exhausted. It should be started in a separate goroutine.
+func RunConsole(in io.Reader, r *Rotary, l *Light) {
+	fmt.Print(consoleHelp)
+	s := bufio.NewScanner(in)
+	for s.Scan() {
+		for _, cmd := range strings.Fields(s.Text()) {
+			if err := runCommand(cmd, r, l); err != nil {
+				fmt.Printf("sim: %s\n", err)
+				fmt.Print(consoleHelp)
+			}
+		}
+	}
+}
+
+func runCommand(cmd string, r *Rotary, l *Light) error {
+	if v, ok := strings.CutPrefix(cmd, "lux="); ok {
+		lux, err := strconv.ParseFloat(v, 32)
+		if err != nil || lux < 0 {
+			return fmt.Errorf("invalid light level %q", v)
+		}
+		l.Set(float32(lux))
+		return nil
+	}
+	switch cmd {
+	case "press":
+		r.Press(true)
+	case "release":
+		r.Press(false)
+	case "click":
+		r.Press(true)
+		<-time.After(clickTime)
+		r.Press(false)
+	default:
+		if len(cmd) == 0 || (cmd[0] != '+' && cmd[0] != '-') {
+			return fmt.Errorf("unknown command %q", cmd)
+		}
+		clicks := 1
+		if len(cmd) > 1 {
+			n, err := strconv.Atoi(cmd[1:])
+			if err != nil {
+				return fmt.Errorf("invalid number of clicks %q", cmd)
+			}
+			clicks = n
+		}
+		if cmd[0] == '-' {
+			clicks = -clicks
+		}
+		r.Turn(clicks)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package sim
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aliher1911/blinds/actuator"
+)
+
+// DCMotor simulates geared DC motor turning blinds. Motion is integrated
+// between speed changes and sensor reads so it only moves while controller
+// keeps driving it. Sensor must be read through motor for shaft to move at
+// constant speed.
+type DCMotor struct {
+	b *Blinds
+	// Shaft speed at full duty in degrees/s.
+	maxSpeed float64
+	// Min duty that overcomes friction.
+	minDuty float64
+
+	mu    sync.Mutex
+	speed float64
+	since time.Time
+	// Fraction of step not made yet.
+	rem float64
+}
+
+func NewDCMotor(b *Blinds, cfg Config) *DCMotor {
+	return &DCMotor{
+		b:        b,
+		maxSpeed: cfg.DCSpeed,
+		minDuty:  cfg.DCMinDuty,
+	}
+}
+
+// advance moves blinds according to speed since last change.
+func (m *DCMotor) advance(now time.Time) {
+	if math.Abs(m.speed) < m.minDuty || m.since.IsZero() {
+		m.since = now
+		return
+	}
+	steps := m.speed*m.maxSpeed*m.b.cfg.StepsPerDegree*now.Sub(m.since).Seconds() + m.rem
+	m.since = now
+	n := int(steps)
+	m.rem = steps - float64(n)
+	dir := 1
+	if n < 0 {
+		dir, n = -1, -n
+	}
+	for i := 0; i < n; i++ {
+		m.b.Step(dir)
+	}
+}
+
+func (m *DCMotor) Drive(speed float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.advance(time.Now())
+	m.speed = math.Max(-1, math.Min(1, speed))
+}
+
+func (m *DCMotor) Step(delta int) {
+}
+
+// Read returns magnetometer reading after moving blinds by time passed
+// since last change.
+func (m *DCMotor) Read() (float32, float32, float32, error) {
+	m.mu.Lock()
+	m.advance(time.Now())
+	m.mu.Unlock()
+	return m.b.Read()
+}
+
+func (m *DCMotor) Close() {
+	m.b.Close()
+}
+
+func (m *DCMotor) PowerOn() {
+}
+
+func (m *DCMotor) PowerOff() {
+	m.Drive(0)
+}
+
+func (m *DCMotor) Capabilities() actuator.Capabilities {
+	return actuator.Capabilities{}
+}
@@ -0,0 +1,33 @@
+package sim
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Light simulates ambient light sensor. Light level is set from console.
+type Light struct {
+	mu  sync.Mutex
+	lux float32
+}
+
+func NewLight(lux float32) *Light {
+	return &Light{lux: lux}
+}
+
+// Set changes measured light level.
+func (l *Light) Set(lux float32) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Printf("sim: Light level %.0f lx\n", lux)
+	l.lux = lux
+}
+
+func (l *Light) Lux() (float32, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lux, nil
+}
+
+func (l *Light) Close() {
+}
@@ -0,0 +1,113 @@
+package sim
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/aliher1911/blinds/i2c"
+	"github.com/aliher1911/blinds/input"
+)
+
+// Rotary simulates seesaw rotary encoder with a button and a NeoPixel.
+type Rotary struct {
+	mu sync.Mutex
+	// Absolute encoder position.
+	pos int
+	// Position change since last delta read.
+	delta int
+	// Current button state and if it changed since last read.
+	button     bool
+	buttonFlag bool
+	// Pending edge on interrupt line.
+	edge bool
+	led  input.Color
+}
+
+func NewRotary() *Rotary {
+	return &Rotary{}
+}
+
+// Turn rotates encoder by number of clicks.
+func (r *Rotary) Turn(clicks int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pos += clicks
+	r.delta += clicks
+	r.edge = true
+}
+
+// Press changes button state.
+func (r *Rotary) Press(pressed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.button != pressed {
+		r.button = pressed
+		r.buttonFlag = true
+		r.edge = true
+	}
+}
+
+func (r *Rotary) Position() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pos, nil
+}
+
+func (r *Rotary) Delta() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := r.delta
+	r.delta = 0
+	return d, nil
+}
+
+func (r *Rotary) SetPosition(newPos int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pos = newPos
+	return nil
+}
+
+func (r *Rotary) Button() (button, interrupt bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	interrupt = r.buttonFlag
+	r.buttonFlag = false
+	return r.button, interrupt, nil
+}
+
+func (r *Rotary) LED(c input.Color) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c != r.led {
+		fmt.Printf("sim: LED %s\n", c)
+		r.led = c
+	}
+	return nil
+}
+
+func (r *Rotary) Close() {
+}
+
+// IntPin returns interrupt line of the encoder.
+func (r *Rotary) IntPin() i2cdev.Interrupt {
+	return intPin{r: r}
+}
+
+type intPin struct {
+	r *Rotary
+}
+
+func (p intPin) Read() bool {
+	p.r.mu.Lock()
+	defer p.r.mu.Unlock()
+	return p.r.delta != 0 || p.r.buttonFlag
+}
+
+func (p intPin) EdgeDetected() bool {
+	p.r.mu.Lock()
+	defer p.r.mu.Unlock()
+	e := p.r.edge
+	p.r.edge = false
+	return e
+}
@@ -0,0 +1,139 @@
+package sim
+
+import (
+	"io"
+	"sync"
+
+	"github.com/aliher1911/blinds/actuator"
+)
+
+// Register bits of TMC2209 model.
+const (
+	gconfSpreadCycle = 1 << 2
+	drvStealth       = 1 << 30
+)
+
+// StallGuard load measurement reported by model when motor runs freely.
+const freeLoad = 300
+
+// TMC2209 models UART register interface of TMC2209 driver on single wire
+// bus. Every written byte is echoed back and valid datagrams addressed to
+// driver are answered like real chip does. Load measurement drops to zero
+// while motor is stalled.
+type TMC2209 struct {
+	addr    uint8
+	stalled func() bool
+
+	mu   sync.Mutex
+	regs map[uint8]uint32
+	// Bytes of incomplete datagram.
+	in []byte
+	// Bytes waiting to be read.
+	out []byte
+}
+
+// NewTMC2209 creates driver model at address. stalled reports if motor is
+// blocked.
+func NewTMC2209(addr uint8, stalled func() bool) *TMC2209 {
+	d := &TMC2209{
+		addr:    addr,
+		stalled: stalled,
+	}
+	d.Reset()
+	return d
+}
+
+// Reset restores power on register values like undervoltage reset of real
+// chip does.
+func (d *TMC2209) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.regs = map[uint8]uint32{
+		actuator.TMCGConf: 0x1c1,
+		// Driver starts with reset flag set.
+		actuator.TMCGStat:    0x1,
+		actuator.TMCIOIn:     actuator.TMCVersion << 24,
+		actuator.TMCChopConf: 0x10000053,
+	}
+}
+
+func (d *TMC2209) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.out = append(d.out, p...)
+	d.in = append(d.in, p...)
+	for len(d.in) >= 4 {
+		if d.in[0] != 0x05 {
+			d.in = d.in[1:]
+			continue
+		}
+		size := 4
+		if d.in[2]&0x80 != 0 {
+			size = 8
+		}
+		if len(d.in) < size {
+			break
+		}
+		dg := d.in[:size]
+		d.in = d.in[size:]
+		if dg[size-1] != actuator.TMCCRC(dg[:size-1]) || dg[1] != d.addr {
+			continue
+		}
+		reg := dg[2] &^ 0x80
+		if size == 8 {
+			d.write(reg, uint32(dg[3])<<24|uint32(dg[4])<<16|uint32(dg[5])<<8|uint32(dg[6]))
+			continue
+		}
+		v := d.read(reg)
+		reply := []byte{0x05, 0xff, reg, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v), 0}
+		reply[7] = actuator.TMCCRC(reply[:7])
+		d.out = append(d.out, reply...)
+	}
+	return len(p), nil
+}
+
+// Read returns pending bytes. Like serial port with timeout it returns EOF
+// when nothing is pending.
+func (d *TMC2209) Read(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.out) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+func (d *TMC2209) write(reg uint8, v uint32) {
+	d.regs[actuator.TMCIfCnt] = (d.regs[actuator.TMCIfCnt] + 1) & 0xff
+	switch reg {
+	case actuator.TMCGStat:
+		// Flags are cleared by writing ones.
+		d.regs[reg] &^= v
+	case actuator.TMCIfCnt, actuator.TMCIOIn, actuator.TMCTStep, actuator.TMCSGResult, actuator.TMCDrvStatus:
+	default:
+		d.regs[reg] = v
+	}
+}
+
+func (d *TMC2209) read(reg uint8) uint32 {
+	switch reg {
+	case actuator.TMCSGResult:
+		if d.stalled() {
+			return 0
+		}
+		return freeLoad
+	case actuator.TMCTStep:
+		// Model always moves fast enough for StallGuard.
+		return 0
+	case actuator.TMCDrvStatus:
+		irun := d.regs[actuator.TMCIHoldIRun] >> 8 & 0x1f
+		v := irun << 16
+		if d.regs[actuator.TMCGConf]&gconfSpreadCycle == 0 {
+			v |= drvStealth
+		}
+		return v
+	}
+	return d.regs[reg]
+}
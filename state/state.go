@@ -0,0 +1,71 @@
+package state
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/aliher1911/blinds/controller"
+	"github.com/aliher1911/blinds/fileutil"
+	"github.com/aliher1911/blinds/ui"
+
+	"gopkg.in/yaml.v3"
+)
+
+// State is runtime state of blinds that survives restarts.
+type State struct {
+	// Last requested shaft angle. controller.NoAngle if never set.
+	Target int32 `yaml:"target"`
+	// Control mode as set by user.
+	Auto bool `yaml:"auto"`
+	// Learned steps per degree, zero if nothing was learned.
+	StepsPerDegree float64 `yaml:"steps_per_degree,omitempty"`
+	// Configured steps per degree the value was learned from. Learned value
+	// is discarded when blinds are recalibrated.
+	CalibratedStepsPerDegree float64 `yaml:"calibrated_steps_per_degree,omitempty"`
+	// Settings changed from device menu, zero if never changed.
+	UI ui.Settings `yaml:"ui,omitempty"`
+}
+
+// Empty returns state used when nothing was saved.
+func Empty() State {
+	return State{
+		Target: controller.NoAngle,
+	}
+}
+
+// Load reads state from file. Missing file is not an error and results in
+// empty state. Corrupted file results in error together with empty state,
+// so that caller could log error and proceed.
+func Load(path string) (State, error) {
+	s := Empty()
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return s, err
+	}
+	defer f.Close()
+
+	if err := yaml.NewDecoder(f).Decode(&s); err != nil && err != io.EOF {
+		return Empty(), fmt.Errorf("failed to parse state %s: %w", path, err)
+	}
+	if math.IsNaN(s.StepsPerDegree) || math.IsInf(s.StepsPerDegree, 0) || s.StepsPerDegree < 0 {
+		return Empty(), fmt.Errorf("invalid steps per degree in state %s: %f", path, s.StepsPerDegree)
+	}
+	return s, nil
+}
+
+// Save writes state to file replacing it atomically, so that file always
+// contains either old or new state if we crash mid way.
+func (s State) Save(path string) error {
+	return fileutil.WriteAtomic(path, 0644, func(w io.Writer) error {
+		e := yaml.NewEncoder(w)
+		if err := e.Encode(s); err != nil {
+			return err
+		}
+		return e.Close()
+	})
+}
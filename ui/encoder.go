@@ -0,0 +1,69 @@
+package ui
+
+import "fmt"
+
+// encoder tracks absolute encoder position in absolute mode. Angle is
+// computed from position relative to the point where encoder was last
+// synced to known angle.
+type encoder struct {
+	pos       int
+	syncPos   int
+	syncAngle int32
+}
+
+// rotation returns clicks since last read. In absolute mode it is computed
+// from encoder position so missed reads don't accumulate error.
+func (u *UI) rotation() (int, error) {
+	if !u.cfg.Absolute {
+		return u.rot.Delta()
+	}
+	p, err := u.rot.Position()
+	if err != nil {
+		return 0, err
+	}
+	d := p - u.enc.pos
+	u.enc.pos = p
+	return d, nil
+}
+
+// positionAngle maps current encoder position to angle. When angle is
+// outside of limits, encoder is synced to the limit so that turning back
+// takes effect immediately.
+func (u *UI) positionAngle() int32 {
+	a := u.enc.syncAngle + int32(u.enc.pos-u.enc.syncPos)*u.clickAngle()
+	if c := u.clamp(a); c != a {
+		u.sync(c)
+		return c
+	}
+	return a
+}
+
+// sync writes encoder position matching angle.
+func (u *UI) sync(angle int32) {
+	pos := int(angle / u.clickAngle())
+	if err := u.rot.SetPosition(pos); err != nil {
+		fmt.Printf("ui: Err setting encoder position: %s\n", err)
+		// Keep mapping relative to position we have.
+		pos = u.enc.pos
+	}
+	u.enc = encoder{
+		pos:       pos,
+		syncPos:   pos,
+		syncAngle: angle,
+	}
+}
+
+// resync syncs encoder to current target in absolute mode.
+func (u *UI) resync() {
+	if u.cfg.Absolute {
+		u.sync(u.doc.GetState().SetAngle)
+	}
+}
+
+// rebase maps last read position to target changed by other controls.
+func (u *UI) rebase(angle int32) {
+	if u.cfg.Absolute && angle != u.enc.syncAngle {
+		u.enc.syncAngle = angle
+		u.enc.syncPos = u.enc.pos
+	}
+}
@@ -0,0 +1,98 @@
+package ui
+
+import "time"
+
+type gesture int
+
+const (
+	noGesture gesture = iota
+	// Press and release without a second press within double click time.
+	shortPress
+	// Button held for long press time. Release is ignored.
+	longPress
+	// Second press within double click time after release.
+	doubleClick
+)
+
+func (g gesture) String() string {
+	switch g {
+	case shortPress:
+		return "short press"
+	case longPress:
+		return "long press"
+	case doubleClick:
+		return "double click"
+	}
+	return "none"
+}
+
+// gestures turns button edges into gestures. Long press and short press
+// are only recognized after timeout so owner must call tick at deadline.
+type gestures struct {
+	longPress   time.Duration
+	doubleClick time.Duration
+
+	pressed bool
+	pressAt time.Time
+	// Current press already produced a gesture.
+	consumed bool
+	// Released after a short press and waiting for a second one.
+	clicked   bool
+	releaseAt time.Time
+}
+
+func newGestures(longPress, doubleClick time.Duration) *gestures {
+	return &gestures{
+		longPress:   longPress,
+		doubleClick: doubleClick,
+	}
+}
+
+// edge feeds button state change.
+func (g *gestures) edge(pressed bool, now time.Time) gesture {
+	if pressed == g.pressed {
+		return noGesture
+	}
+	g.pressed = pressed
+	if pressed {
+		g.pressAt = now
+		g.consumed = false
+		if g.clicked && now.Sub(g.releaseAt) <= g.doubleClick {
+			g.clicked = false
+			g.consumed = true
+			return doubleClick
+		}
+		g.clicked = false
+		return noGesture
+	}
+	if !g.consumed {
+		g.clicked = true
+		g.releaseAt = now
+	}
+	return noGesture
+}
+
+// tick recognizes gestures that completed by timeout.
+func (g *gestures) tick(now time.Time) gesture {
+	switch {
+	case g.pressed && !g.consumed && now.Sub(g.pressAt) >= g.longPress:
+		g.consumed = true
+		return longPress
+	case !g.pressed && g.clicked && now.Sub(g.releaseAt) > g.doubleClick:
+		g.clicked = false
+		return shortPress
+	}
+	return noGesture
+}
+
+// deadline returns time when tick should be called next. Zero time means
+// no gesture is pending.
+func (g *gestures) deadline() time.Time {
+	switch {
+	case g.pressed && !g.consumed:
+		return g.pressAt.Add(g.longPress)
+	case !g.pressed && g.clicked:
+		return g.releaseAt.Add(g.doubleClick + time.Millisecond)
+	}
+	return time.Time{}
+}
@@ -0,0 +1,157 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aliher1911/blinds/input"
+)
+
+type menuItem int
+
+const (
+	minLimitItem menuItem = iota
+	maxLimitItem
+	presetItem
+	autoItem
+	invertItem
+	menuItems
+)
+
+var menuNames = [menuItems]string{"min limit", "max limit", "preset", "auto mode", "invert direction"}
+
+// Items are shown by repeating item color blinks, number of blinks is item
+// position in menu.
+var menuColors = [menuItems]input.Color{input.Blue, input.Green, input.White, input.Cyan, input.Yellow}
+
+// Pause between repeated item indications.
+const menuPause = 800 * time.Millisecond
+
+// menu is a settings menu state. Rotating selects item and short press
+// either toggles it or starts editing its value. While editing rotating
+// changes value, short press saves it and long press returns to item
+// selection. Long press on item selection leaves menu.
+type menu struct {
+	active  bool
+	item    menuItem
+	editing bool
+	value   int32
+}
+
+func (u *UI) enterMenu() {
+	u.menu = menu{active: true}
+	fmt.Printf("ui: Entering settings menu\n")
+	u.showItem()
+}
+
+func (u *UI) leaveMenu() {
+	u.menu = menu{}
+	// Menu rotation and direction change break position mapping.
+	u.resync()
+	fmt.Printf("ui: Leaving settings menu\n")
+	u.ledC <- blink(input.Magenta, 1, blinkSlow)
+}
+
+func (u *UI) showItem() {
+	fmt.Printf("ui: Menu item %s\n", menuNames[u.menu.item])
+	u.ledC <- input.Play(input.LayerUI, u.itemPattern())
+}
+
+// itemPattern repeats item blinks until menu is left.
+func (u *UI) itemPattern() input.Animation {
+	n := int(u.menu.item) + 1
+	return input.Loop(input.Sequence(input.Blink(menuColors[u.menu.item], n, blinkSlow), input.Solid(input.Off, menuPause)), 0)
+}
+
+// valueRange returns range of values for edited item that keeps settings
+// consistent.
+func (u *UI) valueRange() (int32, int32) {
+	step := abs(u.cfg.ClickAngle)
+	switch u.menu.item {
+	case minLimitItem:
+		return u.cfg.MinAngle, u.settings.MaxAngle - step
+	case maxLimitItem:
+		return u.settings.MinAngle + step, u.cfg.MaxAngle
+	}
+	return u.settings.MinAngle, u.settings.MaxAngle
+}
+
+func (u *UI) menuRotate(d int) {
+	if !u.menu.editing {
+		u.menu.item = menuItem((int(u.menu.item) + d%int(menuItems) + int(menuItems)) % int(menuItems))
+		u.showItem()
+		return
+	}
+	min, max := u.valueRange()
+	u.menu.value = clamp(u.menu.value+int32(d)*u.clickAngle(), min, max)
+	u.ledC <- input.NewLedOp(u.angleColor(u.menu.value), u.cfg.MenuTimeout)
+}
+
+func (u *UI) menuGesture(g gesture) {
+	switch g {
+	case shortPress:
+		if u.menu.editing {
+			u.saveValue()
+			return
+		}
+		u.selectItem()
+	case longPress:
+		if u.menu.editing {
+			u.menu.editing = false
+			u.showItem()
+			return
+		}
+		u.leaveMenu()
+	}
+}
+
+// selectItem toggles boolean items and starts editing angle items.
+func (u *UI) selectItem() {
+	switch u.menu.item {
+	case autoItem:
+		u.toggleAuto(u.itemPattern())
+	case invertItem:
+		u.settings.Invert = !u.settings.Invert
+		fmt.Printf("ui: Invert direction set to %t\n", u.settings.Invert)
+		u.doc.SetSettings(u.settings)
+		u.ledC <- blink(input.Green, 3, blinkFast, u.itemPattern())
+	default:
+		u.menu.editing = true
+		switch u.menu.item {
+		case minLimitItem:
+			u.menu.value = u.settings.MinAngle
+		case maxLimitItem:
+			u.menu.value = u.settings.MaxAngle
+		case presetItem:
+			u.menu.value = u.settings.Preset
+		}
+		fmt.Printf("ui: Editing %s %d\n", menuNames[u.menu.item], u.menu.value)
+		u.ledC <- input.NewLedOp(u.angleColor(u.menu.value), u.cfg.MenuTimeout)
+	}
+}
+
+// saveValue applies edited angle and returns to item selection.
+func (u *UI) saveValue() {
+	v := u.menu.value
+	switch u.menu.item {
+	case minLimitItem:
+		u.settings.MinAngle = v
+	case maxLimitItem:
+		u.settings.MaxAngle = v
+	case presetItem:
+		u.settings.Preset = v
+	}
+	// Narrowed limits could exclude preset.
+	u.settings.Preset = clamp(u.settings.Preset, u.settings.MinAngle, u.settings.MaxAngle)
+	fmt.Printf("ui: Set %s to %d\n", menuNames[u.menu.item], v)
+	u.doc.SetSettings(u.settings)
+	u.menu.editing = false
+	u.ledC <- blink(input.Green, 3, blinkFast, u.itemPattern())
+}
+
+func abs(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -13,8 +13,14 @@ type State struct {
 	SetAngle int32
 	// Current blinds angle
 	CurrentAngle int32
+	// Blinds reached set angle
+	AtTarget bool
+	// Blinds stopped because of malfunction
+	Fault error
 	// Control mode (if external system should adaptively control blinds)
 	Auto bool
+	// Blinds position is known and other fields are valid
+	Ready bool
 }
 
 // Update
@@ -22,28 +28,123 @@ type Update interface {
 	SetAngle(angle int32)
 	SetAuto(auto bool)
 	GetState() State
+	// SetSettings persists settings changed from menu.
+	SetSettings(s Settings)
+}
+
+// Document is blinds state controlled by remote APIs.
+type Document interface {
+	Update
+	// Stop interrupts current movement.
+	Stop()
+	// Ready is true once blinds position is known and changes are accepted.
+	Ready() bool
+	// Limits returns range of angles that could be set.
+	Limits() (min, max int32)
+}
+
+// Settings are adjustable from the device menu.
+type Settings struct {
+	// Range of angles that could be set with rotary.
+	MinAngle int32 `yaml:"min_angle"`
+	MaxAngle int32 `yaml:"max_angle"`
+	// Favorite angle set by double click.
+	Preset int32 `yaml:"preset"`
+	// Swap cw/ccw rotation of the encoder.
+	Invert bool `yaml:"invert"`
 }
 
 // UI performs user interaction.
 type UI struct {
 	// UI interrupt
 	intC <-chan time.Time
-	rot  *input.Rotary
+	rot  input.Control
 	ledC chan *input.LedOp
 
 	// Document
 	doc Update
+
+	cfg Config
+
+	gestures *gestures
+	settings Settings
+	menu     menu
+	enc      encoder
+}
+
+type Config struct {
+	// Angle change per encoder click.
+	// Note we can use negative step to invert cw/ccw rotation.
+	// If we do, we also need to adjust LED color formula and swap color rates.
+	ClickAngle int32 `yaml:"click_angle"`
+	// Range of angles that could be set. Menu can narrow it down.
+	MinAngle int32 `yaml:"min_angle"`
+	MaxAngle int32 `yaml:"max_angle"`
+	// After receiving interrupt, wait for a while to mask spurious changes.
+	Debounce time.Duration `yaml:"debounce"`
+	// Wait for more input for the period before applying angle.
+	ApplyTimeout time.Duration `yaml:"apply_timeout"`
+	// Hold button for the period to enter settings menu.
+	LongPress time.Duration `yaml:"long_press"`
+	// Max time between clicks to treat them as double click.
+	DoubleClick time.Duration `yaml:"double_click"`
+	// Leave settings menu without changes after no input for the period.
+	MenuTimeout time.Duration `yaml:"menu_timeout"`
+	// Favorite angle set by double click.
+	Preset int32 `yaml:"preset"`
+	// Map absolute encoder position to angle instead of accumulating
+	// deltas. Encoder is synced to target once blinds position is known.
+	Absolute bool `yaml:"absolute"`
 }
 
-func New(rotary *input.Rotary, intC <-chan time.Time, led chan *input.LedOp, doc Update) *UI {
+func Defaults() Config {
+	return Config{
+		ClickAngle:   -10,
+		MinAngle:     -140,
+		MaxAngle:     140,
+		Debounce:     100 * time.Millisecond,
+		ApplyTimeout: 3 * time.Second,
+		LongPress:    time.Second,
+		DoubleClick:  400 * time.Millisecond,
+		MenuTimeout:  30 * time.Second,
+		Preset:       0,
+	}
+}
+
+func New(rotary input.Control, intC <-chan time.Time, led chan *input.LedOp, doc Update, cfg Config) *UI {
 	return &UI{
-		intC: intC,
-		rot:  rotary,
-		ledC: led,
-		doc:  doc,
+		intC:     intC,
+		rot:      rotary,
+		ledC:     led,
+		doc:      doc,
+		cfg:      cfg,
+		gestures: newGestures(cfg.LongPress, cfg.DoubleClick),
+		settings: cfg.Settings(),
 	}
 }
 
+// Settings returns settings used until changed from menu.
+func (c Config) Settings() Settings {
+	return Settings{
+		MinAngle: c.MinAngle,
+		MaxAngle: c.MaxAngle,
+		Preset:   c.Preset,
+	}
+}
+
+// Restore replaces configured settings with saved ones. Must be called
+// before Run.
+func (u *UI) Restore(s Settings) error {
+	if s.MinAngle >= s.MaxAngle || s.MinAngle < u.cfg.MinAngle || s.MaxAngle > u.cfg.MaxAngle {
+		return fmt.Errorf("angle range [%d, %d] is outside of ui angles", s.MinAngle, s.MaxAngle)
+	}
+	if s.Preset < s.MinAngle || s.Preset > s.MaxAngle {
+		return fmt.Errorf("preset %d is outside of angle range", s.Preset)
+	}
+	u.settings = s
+	return nil
+}
+
 type state int
 
 const (
@@ -55,31 +156,57 @@ const (
 	edit
 )
 
-const debounceT = 100 * time.Millisecond
-const uiApplyT = 3 * time.Second
+const never = time.Duration(1<<63 - 1)
 
-// Note we can use negative step to invert cw/ccw rotation.
-// If we do, we also need to adjust LED color formula and swap color rates.
-const clickAngle = int32(-10)
+// How often state is checked until it is ready to sync absolute encoder.
+const syncPollT = 500 * time.Millisecond
 
-const maxAngle = int32(140)
-const minAngle = int32(-140)
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
 
 // UI State machine loop.
 func (u *UI) Run(ctx context.Context) error {
-	never := time.Duration(1<<63 - 1)
 	s := idle
 	btn := false
 	base := int32(0)
+	changed := false
 	t := time.NewTimer(never)
-	resetT := func(d time.Duration) {
-		if !t.Stop() {
-			select {
-			case <-t.C:
-			default:
-			}
+	defer t.Stop()
+	// Fires when pending gesture times out.
+	gt := time.NewTimer(never)
+	defer gt.Stop()
+	armGesture := func(now time.Time) {
+		if d := u.gestures.deadline(); !d.IsZero() {
+			resetTimer(gt, d.Sub(now))
+		} else {
+			resetTimer(gt, never)
+		}
+	}
+	// Absolute encoder is synced to target once it is known.
+	var syncC <-chan time.Time
+	if u.cfg.Absolute {
+		st := time.NewTicker(syncPollT)
+		defer st.Stop()
+		syncC = st.C
+	}
+	onGesture := func(g gesture) {
+		if g == noGesture {
+			return
+		}
+		fmt.Printf("ui: Button %s\n", g)
+		base, changed = u.handleGesture(g, base, changed)
+		if u.menu.active {
+			// Extend menu while user interacts with it.
+			s = edit
+			resetTimer(t, u.cfg.MenuTimeout)
 		}
-		t.Reset(d)
 	}
 
 	for {
@@ -89,76 +216,183 @@ func (u *UI) Run(ctx context.Context) error {
 			// wait for interrupt and cancel
 			select {
 			case <-ctx.Done():
-				t.Stop()
 				return ctx.Err()
 			case <-u.intC:
 				s = debounce
-				resetT(debounceT)
+				resetTimer(t, u.cfg.Debounce)
 				base = u.doc.GetState().SetAngle
+				changed = false
+				if !u.menu.active {
+					u.rebase(base)
+				}
 				fmt.Printf("ui: Starting edit with base angle %d\n", base)
+			case now := <-gt.C:
+				onGesture(u.gestures.tick(now))
+				armGesture(now)
+			case <-syncC:
+				if st := u.doc.GetState(); st.Ready {
+					u.sync(st.SetAngle)
+					syncC = nil
+				}
 			}
 		case debounce:
 			// wait for timer and cancel
 			select {
 			case <-ctx.Done():
-				t.Stop()
 				return ctx.Err()
-			case <-t.C:
+			case now := <-t.C:
 				// Handle input event
 				s = edit
-				if b, _, err := u.rot.Button(); err == nil {
-					if b != btn && b {
-						// Process button press here
-						fmt.Printf("Button is pressed\n")
+				timeout := u.cfg.ApplyTimeout
+				if u.menu.active {
+					timeout = u.cfg.MenuTimeout
+				}
+				resetTimer(t, timeout)
+				if b, intr, err := u.rot.Button(); err == nil {
+					// Button could be pressed and released while debouncing.
+					if b == btn && intr {
+						onGesture(u.gestures.edge(!b, now))
 					}
+					onGesture(u.gestures.edge(b, now))
 					btn = b
+					armGesture(now)
 				} else {
 					fmt.Printf("ui: Err reading button state: %s\n", err)
 				}
-				if d, err := u.rot.Delta(); err == nil {
-					base += int32(d) * clickAngle
+				if d, err := u.rotation(); err == nil {
 					switch {
-					case base > maxAngle:
-						base = maxAngle
-					case base < minAngle:
-						base = minAngle
+					case d == 0:
+					case u.menu.active:
+						u.menuRotate(d)
+					default:
+						if u.cfg.Absolute {
+							base = u.positionAngle()
+						} else {
+							base = u.clamp(base + int32(d)*u.clickAngle())
+						}
+						changed = true
+						// change color
+						u.ledC <- input.NewLedOp(u.angleColor(base), timeout)
 					}
-					// change color
-					u.ledC <- input.NewLedOp(angleColor(base), uiApplyT)
 				} else {
 					fmt.Printf("ui: Err reading button state: %s\n", err)
 				}
-				resetT(uiApplyT)
 			case <-u.intC:
 				fmt.Printf("ui: Ignoring handling interrupts while debouncing\n")
+			case now := <-gt.C:
+				onGesture(u.gestures.tick(now))
+				armGesture(now)
 			}
 		case edit:
 			// wait for interrupt, cancel or timeout
 			select {
 			case <-ctx.Done():
-				t.Stop()
 				return ctx.Err()
 			case <-u.intC:
 				s = debounce
-				resetT(debounceT)
+				resetTimer(t, u.cfg.Debounce)
 			case <-t.C:
 				s = idle
+				if u.menu.active {
+					u.leaveMenu()
+					break
+				}
+				if !changed {
+					break
+				}
 				// no activity, apply change to angle
 				u.doc.SetAngle(base)
 				fmt.Printf("ui: Finish edit with new angle %d\n", base)
+			case now := <-gt.C:
+				onGesture(u.gestures.tick(now))
+				armGesture(now)
 			}
 		}
 	}
 }
 
-func angleColor(angle int32) input.Color {
-	const fullRange = maxAngle - minAngle
-	zeroBased := (angle - minAngle)
+// handleGesture runs gesture binding and returns updated edit value. In
+// normal mode short press toggles auto mode, double click moves to preset
+// and long press enters settings menu.
+func (u *UI) handleGesture(g gesture, base int32, changed bool) (int32, bool) {
+	if u.menu.active {
+		u.menuGesture(g)
+		return u.doc.GetState().SetAngle, false
+	}
+	switch g {
+	case shortPress:
+		u.toggleAuto()
+	case doubleClick:
+		preset := u.settings.Preset
+		u.doc.SetAngle(preset)
+		u.resync()
+		fmt.Printf("ui: Moving to preset %d\n", preset)
+		u.ledC <- blink(u.angleColor(preset), 2, blinkFast)
+		return preset, false
+	case longPress:
+		u.enterMenu()
+		return u.doc.GetState().SetAngle, false
+	}
+	return base, changed
+}
+
+// toggleAuto switches auto mode and blinks LED followed by optional
+// animations.
+func (u *UI) toggleAuto(then ...input.Animation) {
+	auto := !u.doc.GetState().Auto
+	u.doc.SetAuto(auto)
+	fmt.Printf("ui: Auto mode set to %t\n", auto)
+	if auto {
+		u.ledC <- blink(input.Cyan, 2, blinkSlow, then...)
+	} else {
+		u.ledC <- blink(input.Yellow, 1, blinkSlow, then...)
+	}
+}
+
+const (
+	blinkFast = 150 * time.Millisecond
+	blinkSlow = 400 * time.Millisecond
+)
+
+// blink creates op flashing color n times followed by optional animations.
+func blink(c input.Color, n int, period time.Duration, then ...input.Animation) *input.LedOp {
+	return input.Play(input.LayerUI, input.Sequence(append([]input.Animation{input.Blink(c, n, period)}, then...)...))
+}
+
+func (u *UI) clamp(angle int32) int32 {
+	return clamp(angle, u.settings.MinAngle, u.settings.MaxAngle)
+}
+
+func clamp(angle, min, max int32) int32 {
+	switch {
+	case angle > max:
+		return max
+	case angle < min:
+		return min
+	}
+	return angle
+}
+
+func (u *UI) clickAngle() int32 {
+	if u.settings.Invert {
+		return -u.cfg.ClickAngle
+	}
+	return u.cfg.ClickAngle
+}
+
+func (u *UI) angleColor(angle int32) input.Color {
+	return u.cfg.AngleColor(angle)
+}
+
+// AngleColor maps angle range to colors from blue to green. Angles outside
+// of range get color of the nearest end.
+func (c Config) AngleColor(angle int32) input.Color {
+	fullRange := c.MaxAngle - c.MinAngle
+	zeroBased := (clamp(angle, c.MinAngle, c.MaxAngle) - c.MinAngle)
 	ratio := float32(zeroBased) / float32(fullRange)
 	b := input.Blue.Scale(1 - ratio)
 	g := input.Green.Scale(ratio)
-	c := b.Add(g)
-	return c
+	return b.Add(g)
 }
 
 type LoggerUpdate struct {
@@ -176,9 +410,14 @@ func (l *LoggerUpdate) SetAuto(auto bool) {
 	l.a = auto
 }
 
+func (l *LoggerUpdate) SetSettings(s Settings) {
+	fmt.Printf("Setting settings to %+v\n", s)
+}
+
 func (l *LoggerUpdate) GetState() State {
 	return State{
 		SetAngle: l.d,
 		Auto:     l.a,
+		Ready:    true,
 	}
 }